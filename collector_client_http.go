@@ -201,6 +201,7 @@ func (client *httpCollectorClient) toRequest(
 		client.attributes,
 		buffer,
 	)
+	buffer.reportedBytes = int64(len(hecRequest))
 
 	var outbuf bytes.Buffer
 	gz := gzip.NewWriter(&outbuf)
@@ -3,18 +3,22 @@ package splunktracing
 import (
 	"bytes"
 	"encoding/json"
-	// "fmt"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
-	// "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 )
 
 type hecConverter struct {
 	verbose        bool
 	maxLogKeyLen   int // see GrpcOptions.MaxLogKeyLen
 	maxLogValueLen int // see GrpcOptions.MaxLogValueLen
+	resource       map[string]interface{} // see Options.Resource
+	logLayout      LogLayout // see Options.LogLayout
+	legacyTracerAttributes bool // see Options.LegacyTracerAttributes
 }
 
 type splLog struct {
@@ -28,6 +32,9 @@ func newHECConverter(options Options) *hecConverter {
 		verbose:        options.Verbose,
 		maxLogKeyLen:   options.MaxLogKeyLen,
 		maxLogValueLen: options.MaxLogValueLen,
+		resource:       options.Resource.toMap(),
+		logLayout:      options.LogLayout,
+		legacyTracerAttributes: options.LegacyTracerAttributes,
 	}
 }
 
@@ -61,71 +68,282 @@ func (converter *hecConverter) toSpan(span RawSpan, buffer *reportBuffer, attrib
 	} else {
 		span_map["parent_span_id"] = strconv.FormatUint(span.ParentSpanID, 16)
 	}
-	span_map["trace_id"] 				= strconv.FormatUint(span.Context.TraceID, 16)
+	span_map["trace_id"] 				= span.Context.TraceIDHex()
 	span_map["span_id"] 				= strconv.FormatUint(span.Context.SpanID, 16)
 	span_map["operation_name"] 			= span.Operation
 	// span_map["parent_span_id"] 			= &psi// span.ParentSpanID
 	span_map["timestamp"]				= converter.toTimestamp(span.Start)
 	span_map["duration"] 				= converter.fromDuration(span.Duration)
+	if span.Incomplete {
+		span_map["incomplete"] 			= true
+	}
+	if span.ClockSkew > 0 {
+		span_map["clock_skew"] 			= converter.fromDuration(span.ClockSkew)
+	}
 	span_map["tags"] 					= make(map[string]interface{})
 	span_map["baggage"] 				= &span.Context.Baggage
-	// span_map["Logs"] 					= converter.toLogs(span.Logs, buffer)
+	span_map["resource"] 				= converter.toResource(attributes)
+	span_map["kind"] 					= converter.toKind(span.Tags)
+	span_map["error"], span_map["status"] 	= converter.toStatus(span)
+	span_map["references"] 				= converter.toReferences(span.References)
+	span_map["dropped_tags_count"] 		= span.DroppedTagsCount
+	span_map["links"] 					= converter.toLinks(span.Links, buffer)
+	span_map["sample_weight"] 			= converter.toSampleWeight(span.Context.Sampling)
+	if span.Context.Sampling.SamplerType != "" {
+		span_map[SamplerTypeTagKey] 		= span.Context.Sampling.SamplerType
+		span_map[SamplerParamTagKey] 		= span.Context.Sampling.SamplerParam
+	}
+	if converter.logLayout == LogLayoutEmbedded {
+		span_map["logs"] 				= converter.toLogs(span.Logs, buffer)
+	}
 
-	for key, value := range attributes {
-		if strings.HasPrefix(key, "tracer_") || key == "device" || key == "component_name" {
-			span_map[key] = value
-		} else {
-			span_map["tags"].(map[string]interface{})[key] = value
+	// With Options.LegacyTracerAttributes, the tracer attributes keep the
+	// layout that predates "resource": the tracer_* keys, "device" and
+	// "component_name" at the top level, and the other Options.Tags merged
+	// into "tags", where the span's own tags override them.
+	if converter.legacyTracerAttributes {
+		for key, value := range attributes {
+			if strings.HasPrefix(key, "tracer_") || key == HostnameKey || key == ComponentNameKey {
+				span_map[key] = value
+			} else {
+				span_map["tags"].(map[string]interface{})[key] = value
+			}
 		}
 	}
-	for key, value := range span.Tags {
-			span_map["tags"].(map[string]interface{})[key] = value
-	}
+	tagEncoder := splunkTagEncoder{converter: converter, buffer: buffer}
+	tagEncoder.encodeTags(span_map["tags"].(map[string]interface{}), span.Tags)
 	span_thing := make(map[string]interface{})
 	span_thing["time"] = converter.toTimestamp(span.Start)
 	span_thing["sourcetype"] = "splunktracing:span"
 	span_thing["event"] = span_map		
-	span_buffer, _ := json.Marshal(span_thing)
+	span_buffer, err := json.Marshal(span_thing)
+	if err != nil {
+		converter.reportEncodingError(buffer, span.Operation, err)
+	}
+
+	if converter.logLayout == LogLayoutEmbedded {
+		return span_buffer
+	}
 
 	// report_objs := make([][]byte, 1) 
 	report_objs := make([][]byte, len(span.Logs) + 1)
 	report_objs[0] = span_buffer
 	//
 	for idx, record := range span.Logs {
-		log_map := make(map[string]interface{})
-		log_map["timestamp"] = converter.toTimestamp(record.Timestamp)
-		for k, v := range span_map {
-			if k!="duration" && k!="timestamp" {
-		    	log_map[k] = v
-		    }
+		log_map := converter.toLog(record, buffer)
+		if converter.logLayout == LogLayoutTrimmed {
+			for _, k := range []string{"trace_id", "span_id", "parent_span_id"} {
+				log_map[k] = span_map[k]
+			}
+		} else {
+			for k, v := range span_map {
+				if k!="duration" && k!="timestamp" {
+			    	log_map[k] = v
+			    }
+			}
 		}
 		log_thing := make(map[string]interface{})
 		log_thing["time"] = converter.toTimestamp(record.Timestamp)
 		log_thing["sourcetype"] = "splunktracing:log"
-		marshalFields(converter, log_map, record.Fields)
 		log_thing["event"] = log_map
-		log_buffer, _ := json.Marshal(log_thing)
+		log_buffer, err := json.Marshal(log_thing)
+		if err != nil {
+			converter.reportEncodingError(buffer, span.Operation, err)
+		}
 		report_objs[idx+1] = log_buffer
 	}
 	//
 	return bytes.Join(report_objs, []byte("\n"))
 }
 
-// func (converter *hecConverter) toLogs(records []opentracing.LogRecord, buffer *reportBuffer) []*collectorpb.Log {
-// 	logs := make([]*collectorpb.Log, len(records))
-// 	for i, record := range records {
-// 		logs[i] = converter.toLog(record, buffer)
-// 	}
-// 	return logs
-// }
+// toResource returns the "resource" object of a span event: Options.Resource,
+// and the tracer attributes unless they keep their legacy layout. The
+// "component_name" and "device" attributes are left out, as they are
+// reported as service.name and host.name.
+func (converter *hecConverter) toResource(attributes map[string]string) map[string]interface{} {
+	if converter.legacyTracerAttributes || len(attributes) == 0 {
+		return converter.resource
+	}
+	resource := make(map[string]interface{}, len(attributes) + len(converter.resource))
+	for key, value := range attributes {
+		if key != ComponentNameKey && key != HostnameKey {
+			resource[key] = value
+		}
+	}
+	for key, value := range converter.resource {
+		resource[key] = value
+	}
+	return resource
+}
 
-// func (converter *hecConverter) toLog(record opentracing.LogRecord, buffer *reportBuffer) *collectorpb.Log {
-// 	log := &collectorpb.Log{
-// 		Timestamp: converter.toTimestamp(record.Timestamp),
-// 	}
-// 	marshalFields(converter, log, record.Fields, buffer)
-// 	return log
-// }
+// toLogs returns the "logs" array of LogLayoutEmbedded, in order.
+func (converter *hecConverter) toLogs(records []opentracing.LogRecord, buffer *reportBuffer) []map[string]interface{} {
+	logs := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		logs[i] = converter.toLog(record, buffer)
+	}
+	return logs
+}
+
+// toLog returns the timestamp and fields of a log record.
+func (converter *hecConverter) toLog(record opentracing.LogRecord, buffer *reportBuffer) map[string]interface{} {
+	log := map[string]interface{}{
+		"timestamp": converter.toTimestamp(record.Timestamp),
+	}
+	marshalFields(converter, buffer, log, record.Fields)
+	return log
+}
+
+// reportEncodingError accounts for an event that could not be encoded, which
+// the tag and log field encoders should prevent.
+func (converter *hecConverter) reportEncodingError(buffer *reportBuffer, operation string, err error) {
+	emitEvent(newEventUnsupportedValue(operation, nil, err))
+	buffer.logEncoderErrorCount++
+}
+
+// Span kinds reported in the HEC "kind" field.
+const (
+	hecKindInternal = "internal"
+)
+
+// toKind maps the span.kind tag onto the HEC "kind" field: "client",
+// "server", "producer", "consumer", or any other value of the tag as given,
+// in lower case. Spans without the tag are "internal".
+func (converter *hecConverter) toKind(tags opentracing.Tags) string {
+	kind, found := tags[string(ext.SpanKind)]
+	if !found {
+		return hecKindInternal
+	}
+	return strings.ToLower(fmt.Sprint(kind))
+}
+
+// toStatus derives the HEC "error" and "status" fields.
+//
+// "error" is true when the error tag is true (as a bool, or the string
+// "true"), or when the HTTP status code is 5xx, or 4xx for a client span.
+//
+// "status" is an object with a "code" of "ok" or "error", the
+// "http_status_code" from the http.status_code tag if it is set, and a
+// "message" if one is known: the error.message tag, or else the "message",
+// "error.object" or "error" (as logged by log.Error) field of the first log
+// with an "event" field of "error".
+func (converter *hecConverter) toStatus(span RawSpan) (bool, map[string]interface{}) {
+	status := make(map[string]interface{})
+
+	isError := false
+	switch v := span.Tags[string(ext.Error)].(type) {
+	case bool:
+		isError = v
+	case string:
+		isError, _ = strconv.ParseBool(v)
+	}
+
+	if code, ok := converter.toHTTPStatusCode(span.Tags[string(ext.HTTPStatusCode)]); ok {
+		status["http_status_code"] = code
+		if code >= 500 || (code >= 400 && converter.toKind(span.Tags) == string(ext.SpanKindRPCClientEnum)) {
+			isError = true
+		}
+	}
+
+	if message := converter.toErrorMessage(span); message != "" {
+		status["message"] = message
+	}
+
+	status["code"] = "ok"
+	if isError {
+		status["code"] = "error"
+	}
+	return isError, status
+}
+
+func (converter *hecConverter) toHTTPStatusCode(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case uint16:
+		return int(v), true
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case uint32:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	case string:
+		code, err := strconv.Atoi(v)
+		return code, err == nil
+	}
+	return 0, false
+}
+
+func (converter *hecConverter) toErrorMessage(span RawSpan) string {
+	if message, found := span.Tags["error.message"]; found {
+		return fmt.Sprint(message)
+	}
+	for _, record := range span.Logs {
+		var isErrorEvent bool
+		var message string
+		for _, field := range record.Fields {
+			switch field.Key() {
+			case "event":
+				isErrorEvent = fmt.Sprint(field.Value()) == "error"
+			case "message", "error.object", "error":
+				if message == "" {
+					message = fmt.Sprint(field.Value())
+				}
+			}
+		}
+		if isErrorEvent && message != "" {
+			return message
+		}
+	}
+	return ""
+}
+
+// toReferences lists a span's references, parent first, as objects with a
+// type of "child_of" or "follows_from" and the referenced trace and span IDs.
+func (converter *hecConverter) toReferences(references []SpanReference) []map[string]string {
+	refs := make([]map[string]string, len(references))
+	for i, ref := range references {
+		refType := "child_of"
+		if ref.Type == opentracing.FollowsFromRef {
+			refType = "follows_from"
+		}
+		refs[i] = map[string]string{
+			"type":     refType,
+			"trace_id": traceIDToHex(ref.TraceIDHigh, ref.TraceID),
+			"span_id":  strconv.FormatUint(ref.SpanID, 16),
+		}
+	}
+	return refs
+}
+
+// toLinks lists a span's links as objects with the linked trace and span IDs
+// and the link's attributes.
+func (converter *hecConverter) toLinks(links []SpanLink, buffer *reportBuffer) []map[string]interface{} {
+	tagEncoder := splunkTagEncoder{converter: converter, buffer: buffer}
+	hecLinks := make([]map[string]interface{}, len(links))
+	for i, link := range links {
+		attributes := make(map[string]interface{}, len(link.Attributes))
+		tagEncoder.encodeTags(attributes, link.Attributes)
+		hecLinks[i] = map[string]interface{}{
+			"trace_id":   traceIDToHex(link.TraceIDHigh, link.TraceID),
+			"span_id":    strconv.FormatUint(link.SpanID, 16),
+			"attributes": attributes,
+		}
+	}
+	return hecLinks
+}
+
+// toSampleWeight returns the number of traces a reported span stands for,
+// which is the same for every span of a trace.
+func (converter *hecConverter) toSampleWeight(sampling SamplingInfo) float64 {
+	if sampling.Weight <= 0 {
+		return 1
+	}
+	return sampling.Weight
+}
 
 func (converter *hecConverter) toTimestamp(t time.Time) float64 {
 	return float64(t.Unix()) + float64(t.Nanosecond())/1000000000
@@ -0,0 +1,211 @@
+package splunktracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// hecEvents decodes the newline-separated HEC events of a converted span.
+func hecEvents(data []byte) []map[string]interface{} {
+	var events []map[string]interface{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var event map[string]interface{}
+		Expect(json.Unmarshal(line, &event)).To(Succeed())
+		events = append(events, event["event"].(map[string]interface{}))
+	}
+	return events
+}
+
+var _ = Describe("hecConverter", func() {
+	var converter *hecConverter
+	var span RawSpan
+
+	BeforeEach(func() {
+		converter = newHECConverter(Options{})
+		span = RawSpan{
+			Context:   SpanContext{TraceID: 1, SpanID: 2, Sampled: true},
+			Operation: "op",
+			Start:     time.Unix(1500000000, 0),
+			Duration:  time.Millisecond,
+		}
+	})
+
+	convert := func() []map[string]interface{} {
+		return hecEvents(converter.toSpan(span, &reportBuffer{}, nil))
+	}
+
+	Describe("kind, status and error", func() {
+		It("reports internal, ok spans by default", func() {
+			event := convert()[0]
+			Expect(event).To(HaveKeyWithValue("kind", "internal"))
+			Expect(event).To(HaveKeyWithValue("error", false))
+			Expect(event).To(HaveKeyWithValue("status", map[string]interface{}{"code": "ok"}))
+		})
+
+		It("promotes span.kind", func() {
+			span.Tags = opentracing.Tags{string(ext.SpanKind): ext.SpanKindRPCServerEnum}
+			Expect(convert()[0]).To(HaveKeyWithValue("kind", "server"))
+
+			span.Tags = opentracing.Tags{string(ext.SpanKind): "Producer"}
+			Expect(convert()[0]).To(HaveKeyWithValue("kind", "producer"))
+		})
+
+		It("promotes the error tag and an error message", func() {
+			span.Tags = opentracing.Tags{string(ext.Error): true, "error.message": "boom"}
+			event := convert()[0]
+			Expect(event).To(HaveKeyWithValue("error", true))
+			Expect(event).To(HaveKeyWithValue("status", map[string]interface{}{"code": "error", "message": "boom"}))
+
+			span.Tags = opentracing.Tags{string(ext.Error): "true"}
+			Expect(convert()[0]).To(HaveKeyWithValue("error", true))
+		})
+
+		It("takes the message from an error log", func() {
+			span.Tags = opentracing.Tags{string(ext.Error): true}
+			span.Logs = []opentracing.LogRecord{
+				{Timestamp: span.Start, Fields: []log.Field{log.String("message", "not an error")}},
+				{Timestamp: span.Start, Fields: []log.Field{log.String("event", "error"), log.Error(errors.New("timeout"))}},
+			}
+			status := convert()[0]["status"]
+			Expect(status).To(HaveKeyWithValue("message", "timeout"))
+		})
+
+		It("maps HTTP status codes", func() {
+			for _, c := range []struct {
+				kind    ext.SpanKindEnum
+				code    interface{}
+				isError bool
+			}{
+				{ext.SpanKindRPCServerEnum, uint16(200), false},
+				{ext.SpanKindRPCServerEnum, uint16(404), false},
+				{ext.SpanKindRPCClientEnum, 404, true},
+				{ext.SpanKindRPCServerEnum, "503", true},
+			} {
+				span.Tags = opentracing.Tags{string(ext.SpanKind): c.kind, string(ext.HTTPStatusCode): c.code}
+				event := convert()[0]
+				Expect(event).To(HaveKeyWithValue("error", c.isError))
+				Expect(event["status"]).To(HaveKey("http_status_code"))
+				Expect(event["status"].(map[string]interface{})["http_status_code"]).To(BeNumerically(">=", 200))
+			}
+		})
+	})
+
+	Describe("references", func() {
+		It("lists every reference with its type", func() {
+			span.ParentSpanID = 2
+			span.References = []SpanReference{
+				{Type: opentracing.ChildOfRef, TraceID: 1, SpanID: 2},
+				{Type: opentracing.FollowsFromRef, TraceID: 3, TraceIDHigh: 4, SpanID: 0xa},
+			}
+			event := convert()[0]
+			Expect(event).To(HaveKeyWithValue("parent_span_id", "2"))
+			Expect(event["references"]).To(Equal([]interface{}{
+				map[string]interface{}{"type": "child_of", "trace_id": "1", "span_id": "2"},
+				map[string]interface{}{"type": "follows_from", "trace_id": "00000000000000040000000000000003", "span_id": "a"},
+			}))
+		})
+
+		It("reports an empty list for root spans", func() {
+			Expect(convert()[0]["references"]).To(BeEmpty())
+		})
+	})
+
+	It("reports the number of dropped tags", func() {
+		Expect(convert()[0]).To(HaveKeyWithValue("dropped_tags_count", 0.0))
+		span.DroppedTagsCount = 3
+		Expect(convert()[0]).To(HaveKeyWithValue("dropped_tags_count", 3.0))
+	})
+
+	Describe("links", func() {
+		It("lists every link with its attributes", func() {
+			span.Links = []SpanLink{
+				{TraceID: 3, SpanID: 0xa, Attributes: opentracing.Tags{"reason": "retry"}},
+				{TraceID: 5, SpanID: 6},
+			}
+			Expect(convert()[0]["links"]).To(Equal([]interface{}{
+				map[string]interface{}{"trace_id": "3", "span_id": "a", "attributes": map[string]interface{}{"reason": "retry"}},
+				map[string]interface{}{"trace_id": "5", "span_id": "6", "attributes": map[string]interface{}{}},
+			}))
+		})
+
+		It("reports an empty list for spans without links", func() {
+			Expect(convert()[0]["links"]).To(BeEmpty())
+		})
+	})
+
+	Describe("sampling annotations", func() {
+		It("reports a weight of one when no sampler decided", func() {
+			event := convert()[0]
+			Expect(event).To(HaveKeyWithValue("sample_weight", 1.0))
+			Expect(event).NotTo(HaveKey(SamplerTypeTagKey))
+		})
+
+		It("reports the trace's sampler and weight", func() {
+			span.Context.Sampling = SamplingInfo{
+				SamplerType:  SamplerTypeProbabilistic,
+				SamplerParam: 0.25,
+				Weight:       4,
+			}
+			event := convert()[0]
+			Expect(event).To(HaveKeyWithValue(SamplerTypeTagKey, SamplerTypeProbabilistic))
+			Expect(event).To(HaveKeyWithValue(SamplerParamTagKey, 0.25))
+			Expect(event).To(HaveKeyWithValue("sample_weight", 4.0))
+		})
+	})
+
+	Describe("log layouts", func() {
+		BeforeEach(func() {
+			span.Tags = opentracing.Tags{"team": "payments"}
+			span.Logs = []opentracing.LogRecord{
+				{Timestamp: span.Start, Fields: []log.Field{log.String("event", "first")}},
+				{Timestamp: span.Start.Add(time.Millisecond), Fields: []log.Field{log.Int("n", 2)}},
+			}
+		})
+
+		It("repeats the span in separate log events by default", func() {
+			events := convert()
+			Expect(events).To(HaveLen(3))
+			Expect(events[0]).NotTo(HaveKey("logs"))
+			Expect(events[1]).To(HaveKeyWithValue("fields", map[string]interface{}{"event": "first"}))
+			Expect(events[1]).To(HaveKeyWithValue("tags", map[string]interface{}{"team": "payments"}))
+			Expect(events[1]).To(HaveKeyWithValue("operation_name", "op"))
+			Expect(events[1]).NotTo(HaveKey("duration"))
+		})
+
+		It("trims separate log events to IDs and fields", func() {
+			converter = newHECConverter(Options{LogLayout: LogLayoutTrimmed})
+			events := convert()
+			Expect(events).To(HaveLen(3))
+			Expect(events[2]).To(Equal(map[string]interface{}{
+				"timestamp":      events[2]["timestamp"],
+				"trace_id":       "1",
+				"span_id":        "2",
+				"parent_span_id": nil,
+				"fields":         map[string]interface{}{"n": 2.0},
+			}))
+		})
+
+		It("embeds the logs in the span event", func() {
+			converter = newHECConverter(Options{LogLayout: LogLayoutEmbedded})
+			events := convert()
+			Expect(events).To(HaveLen(1))
+			logs := events[0]["logs"].([]interface{})
+			Expect(logs).To(HaveLen(2))
+			Expect(logs[0]).To(HaveKeyWithValue("fields", map[string]interface{}{"event": "first"}))
+			Expect(logs[1]).To(HaveKeyWithValue("fields", map[string]interface{}{"n": 2.0}))
+		})
+
+		It("rejects unknown layouts", func() {
+			opts := Options{LogLayout: "nested"}
+			Expect(opts.Initialize()).NotTo(Succeed())
+		})
+	})
+})
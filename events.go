@@ -153,6 +153,16 @@ type EventStatusReport interface {
 	SentSpans() int
 	DroppedSpans() int
 	EncodingErrors() int
+	// SampledTraces and RejectedTraces count the Sampler's decisions on
+	// new traces. Both are zero when no Sampler is configured.
+	SampledTraces() int
+	RejectedTraces() int
+	// SamplingRate is the current rate of an adaptive Sampler, or zero when
+	// the Sampler does not adapt.
+	SamplingRate() float64
+	// Redactions counts the values masked, hashed or dropped by
+	// Options.Redaction.
+	Redactions() int
 }
 
 type eventStatusReport struct {
@@ -161,6 +171,10 @@ type eventStatusReport struct {
 	sentSpans      int
 	droppedSpans   int
 	encodingErrors int
+	sampledTraces  int
+	rejectedTraces int
+	samplingRate   float64
+	redactions     int
 }
 
 func newEventStatusReport(
@@ -184,6 +198,19 @@ func (s *eventStatusReport) SetSentSpans(sent int) {
 	s.sentSpans = sent
 }
 
+func (s *eventStatusReport) setSamplingCounts(sampled, rejected int) {
+	s.sampledTraces = sampled
+	s.rejectedTraces = rejected
+}
+
+func (s *eventStatusReport) setSamplingRate(rate float64) {
+	s.samplingRate = rate
+}
+
+func (s *eventStatusReport) setRedactions(redactions int) {
+	s.redactions = redactions
+}
+
 func (s *eventStatusReport) StartTime() time.Time {
 	return s.startTime
 }
@@ -208,12 +235,32 @@ func (s *eventStatusReport) EncodingErrors() int {
 	return s.encodingErrors
 }
 
+func (s *eventStatusReport) SampledTraces() int {
+	return s.sampledTraces
+}
+
+func (s *eventStatusReport) RejectedTraces() int {
+	return s.rejectedTraces
+}
+
+func (s *eventStatusReport) SamplingRate() float64 {
+	return s.samplingRate
+}
+
+func (s *eventStatusReport) Redactions() int {
+	return s.redactions
+}
+
 func (s *eventStatusReport) String() string {
 	return fmt.Sprint(
 		"STATUS REPORT start: ", s.startTime,
 		", end: ", s.finishTime,
 		", dropped spans: ", s.droppedSpans,
 		", encoding errors: ", s.encodingErrors,
+		", sampled traces: ", s.sampledTraces,
+		", rejected traces: ", s.rejectedTraces,
+		", sampling rate: ", s.samplingRate,
+		", redactions: ", s.redactions,
 	)
 }
 
@@ -308,6 +355,137 @@ func (e *eventUnsupportedValue) Err() error {
 	return e.err
 }
 
+// EventBaggageDropped occurs when baggage items are dropped, either because
+// they are malformed or because they exceed the configured baggage limits.
+// A single event covers all items dropped by one Extract or SetBaggageItem.
+type EventBaggageDropped interface {
+	ErrorEvent
+	EventBaggageDropped()
+	DroppedItems() int
+}
+
+type eventBaggageDropped struct {
+	droppedItems int
+	err          error
+}
+
+func newEventBaggageDropped(droppedItems int, reason error) *eventBaggageDropped {
+	return &eventBaggageDropped{
+		droppedItems: droppedItems,
+		err:          fmt.Errorf("dropped %d baggage item(s): %v", droppedItems, reason),
+	}
+}
+
+func (*eventBaggageDropped) Event()               {}
+func (*eventBaggageDropped) EventBaggageDropped() {}
+
+func (e *eventBaggageDropped) DroppedItems() int {
+	return e.droppedItems
+}
+
+func (e *eventBaggageDropped) String() string {
+	return e.err.Error()
+}
+
+func (e *eventBaggageDropped) Error() string {
+	return e.err.Error()
+}
+
+func (e *eventBaggageDropped) Err() error {
+	return e.err
+}
+
+// EventSamplingConfigChanged occurs when a new remote sampling strategy is
+// applied.
+type EventSamplingConfigChanged interface {
+	Event
+	EventSamplingConfigChanged()
+	Strategy() string
+}
+
+type eventSamplingConfigChanged struct {
+	strategy string
+}
+
+func newEventSamplingConfigChanged(strategy string) *eventSamplingConfigChanged {
+	return &eventSamplingConfigChanged{strategy: strategy}
+}
+
+func (*eventSamplingConfigChanged) Event()                      {}
+func (*eventSamplingConfigChanged) EventSamplingConfigChanged() {}
+
+func (e *eventSamplingConfigChanged) Strategy() string {
+	return e.strategy
+}
+
+func (e *eventSamplingConfigChanged) String() string {
+	return "sampling strategy changed: " + e.strategy
+}
+
+// EventSamplingConfigError occurs when the remote sampling strategy cannot be
+// fetched or parsed. The last good strategy stays in effect.
+type EventSamplingConfigError interface {
+	ErrorEvent
+	EventSamplingConfigError()
+}
+
+type eventSamplingConfigError struct {
+	err error
+}
+
+func newEventSamplingConfigError(err error) *eventSamplingConfigError {
+	return &eventSamplingConfigError{err: err}
+}
+
+func (*eventSamplingConfigError) Event()                    {}
+func (*eventSamplingConfigError) EventSamplingConfigError() {}
+
+func (e *eventSamplingConfigError) String() string {
+	return e.err.Error()
+}
+
+func (e *eventSamplingConfigError) Error() string {
+	return e.err.Error()
+}
+
+func (e *eventSamplingConfigError) Err() error {
+	return e.err
+}
+
+// EventClockSkew occurs when a span finishes before it starts, because its
+// explicit start or finish time came from a clock that disagrees with the
+// other one. The span is reported with a zero duration and its clock_skew.
+type EventClockSkew interface {
+	Event
+	EventClockSkew()
+	Operation() string
+	Skew() time.Duration
+}
+
+type eventClockSkew struct {
+	operation string
+	skew      time.Duration
+}
+
+func newEventClockSkew(operation string, skew time.Duration) *eventClockSkew {
+	return &eventClockSkew{operation: operation, skew: skew}
+}
+
+func (*eventClockSkew) Event()          {}
+func (*eventClockSkew) EventClockSkew() {}
+
+func (e *eventClockSkew) Operation() string {
+	return e.operation
+}
+
+func (e *eventClockSkew) Skew() time.Duration {
+	return e.skew
+}
+
+func (e *eventClockSkew) String() string {
+	return fmt.Sprintf("span %q finished %v before it started; its duration is clamped to zero", e.operation, e.skew)
+}
+
 const tracerDisabled = "the tracer has been disabled"
 
 // EventTracerDisabled occurs when a tracer is disabled by either the user or
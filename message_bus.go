@@ -0,0 +1,54 @@
+package splunktracing
+
+import (
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// StartProducerSpan starts a span for publishing a message to destination and
+// injects its context into carrier using the opentracing.TextMap format. The
+// span is a child of parent, which may be nil. The span is returned even if
+// the injection fails.
+func StartProducerSpan(
+	tracer opentracing.Tracer,
+	operationName string,
+	destination string,
+	parent opentracing.SpanContext,
+	carrier opentracing.TextMapWriter,
+	opts ...opentracing.StartSpanOption,
+) (opentracing.Span, error) {
+	sso := []opentracing.StartSpanOption{
+		ext.SpanKindProducer,
+		opentracing.Tag{Key: string(ext.MessageBusDestination), Value: destination},
+	}
+	if parent != nil {
+		sso = append(sso, opentracing.ChildOf(parent))
+	}
+	span := tracer.StartSpan(operationName, append(sso, opts...)...)
+	return span, tracer.Inject(span.Context(), opentracing.TextMap, carrier)
+}
+
+// StartConsumerSpan extracts the producer's context from carrier and starts a
+// span for consuming the message, with a FollowsFrom reference to the
+// producer: the producer does not wait for the message to be processed. When
+// carrier holds no context, the span starts a new trace. Any other extraction
+// error is returned alongside the span.
+func StartConsumerSpan(
+	tracer opentracing.Tracer,
+	operationName string,
+	destination string,
+	carrier opentracing.TextMapReader,
+	opts ...opentracing.StartSpanOption,
+) (opentracing.Span, error) {
+	sso := []opentracing.StartSpanOption{
+		ext.SpanKindConsumer,
+		opentracing.Tag{Key: string(ext.MessageBusDestination), Value: destination},
+	}
+	producer, err := tracer.Extract(opentracing.TextMap, carrier)
+	if err == nil {
+		sso = append(sso, opentracing.FollowsFrom(producer))
+	} else if err == opentracing.ErrSpanContextNotFound {
+		err = nil
+	}
+	return tracer.StartSpan(operationName, append(sso, opts...)...), err
+}
@@ -0,0 +1,62 @@
+package splunktracing
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+var _ = Describe("Message bus helpers", func() {
+	var tracer *tracerImpl
+	var recorder *countingRecorder
+
+	BeforeEach(func() {
+		recorder = &countingRecorder{}
+		tracer = newTestTracer(Options{Recorder: recorder})
+	})
+
+	AfterEach(func() {
+		closeTestTracer(tracer)
+	})
+
+	It("links the consumer to the producer with a FollowsFrom reference", func() {
+		parent := tracer.StartSpan("handle request")
+		headers := MessageHeadersCarrier{}
+
+		producer, err := StartProducerSpan(tracer, "send", "orders", parent.Context(), &headers)
+		Expect(err).NotTo(HaveOccurred())
+		producer.Finish()
+
+		consumer, err := StartConsumerSpan(tracer, "receive", "orders", headers)
+		Expect(err).NotTo(HaveOccurred())
+		consumer.Finish()
+
+		spans := recorder.Spans()
+		Expect(spans).To(HaveLen(2))
+		sent, received := spans[0], spans[1]
+
+		Expect(sent.ParentSpanID).To(Equal(parent.Context().(SpanContext).SpanID))
+		Expect(sent.Tags).To(HaveKeyWithValue(string(ext.SpanKind), ext.SpanKindProducerEnum))
+		Expect(sent.Tags).To(HaveKeyWithValue(string(ext.MessageBusDestination), "orders"))
+
+		Expect(received.Context.TraceID).To(Equal(sent.Context.TraceID))
+		Expect(received.ParentSpanID).To(Equal(sent.Context.SpanID))
+		Expect(received.Tags).To(HaveKeyWithValue(string(ext.SpanKind), ext.SpanKindConsumerEnum))
+		Expect(received.Tags).To(HaveKeyWithValue(string(ext.MessageBusDestination), "orders"))
+	})
+
+	It("starts a new trace when the message carries no context", func() {
+		consumer, err := StartConsumerSpan(tracer, "receive", "orders", MessageHeadersCarrier{})
+		Expect(err).NotTo(HaveOccurred())
+		consumer.Finish()
+		Expect(recorder.Spans()[0].ParentSpanID).To(BeZero())
+	})
+
+	It("reports corrupt contexts", func() {
+		headers := MessageHeadersCarrier{{Key: fieldNameTraceID, Value: []byte("zz")}}
+		consumer, err := StartConsumerSpan(tracer, "receive", "orders", headers)
+		Expect(err).To(Equal(opentracing.ErrSpanContextCorrupted))
+		Expect(consumer).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,149 @@
+package splunktracing
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// OpenSpan describes a span that has started but not finished, see
+// OpenSpans.
+type OpenSpan struct {
+	Operation string
+
+	// The span's trace ID and span ID.
+	TraceID     uint64
+	TraceIDHigh uint64
+	SpanID      uint64
+
+	Start time.Time
+	// How long the span has been open.
+	Age time.Duration
+}
+
+// openSpanRegistry tracks the unfinished spans of a tracer, when
+// Options.TrackOpenSpans is set. It holds at most max spans; spans started
+// while it is full are not tracked. A nil registry tracks nothing.
+type openSpanRegistry struct {
+	max int
+
+	// lock guards spans. It is never held while locking a span, which may
+	// be holding its own lock while it finishes.
+	lock  sync.Mutex
+	spans map[*spanImpl]struct{}
+}
+
+func newOpenSpanRegistry(max int) *openSpanRegistry {
+	return &openSpanRegistry{
+		max:   max,
+		spans: make(map[*spanImpl]struct{}),
+	}
+}
+
+func (r *openSpanRegistry) add(sp *spanImpl) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.spans) < r.max {
+		r.spans[sp] = struct{}{}
+	}
+}
+
+func (r *openSpanRegistry) remove(sp *spanImpl) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.spans, sp)
+}
+
+// list returns the tracked spans, oldest first.
+func (r *openSpanRegistry) list() []*spanImpl {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	spans := make([]*spanImpl, 0, len(r.spans))
+	for sp := range r.spans {
+		spans = append(spans, sp)
+	}
+	r.lock.Unlock()
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Start().Before(spans[j].Start())
+	})
+	return spans
+}
+
+// describe returns the OpenSpans of the tracked spans that are still open,
+// oldest first.
+func (r *openSpanRegistry) describe() []OpenSpan {
+	var open []OpenSpan
+	for _, sp := range r.list() {
+		sp.Lock()
+		if !sp.finished {
+			open = append(open, OpenSpan{
+				Operation:   sp.raw.Operation,
+				TraceID:     sp.raw.Context.TraceID,
+				TraceIDHigh: sp.raw.Context.TraceIDHigh,
+				SpanID:      sp.raw.Context.SpanID,
+				Start:       sp.raw.Start,
+				Age:         openSpanAge(sp.raw.Start),
+			})
+		}
+		sp.Unlock()
+	}
+	return open
+}
+
+// openSpanAge returns how long ago a span started, or 0 for a start time
+// ahead of this clock.
+func openSpanAge(start time.Time) time.Duration {
+	if age := time.Since(start); age > 0 {
+		return age
+	}
+	return 0
+}
+
+// partialSpans returns snapshots of the tracked spans that are still open
+// and sampled, marked Incomplete, with their duration so far.
+func (r *openSpanRegistry) partialSpans() []RawSpan {
+	var partial []RawSpan
+	for _, sp := range r.list() {
+		if raw, ok := sp.partialSpan(); ok {
+			partial = append(partial, raw)
+		}
+	}
+	return partial
+}
+
+// partialSpan returns a snapshot of an open, sampled span. The tags and logs
+// are copied, since the span may still change them, and the copy gets the
+// baggage tags and ordered logs of a finished span.
+func (s *spanImpl) partialSpan() (RawSpan, bool) {
+	s.Lock()
+	defer s.Unlock()
+	if s.finished || !s.raw.Context.Sampled {
+		return RawSpan{}, false
+	}
+
+	raw := copyRawSpan(s.raw)
+	raw.Incomplete = true
+	raw.Duration = time.Since(raw.Start)
+	if raw.Duration < 0 {
+		raw.Duration = 0
+	}
+	decircularizeLogs(raw.Logs, s.numDroppedLogs)
+	s.tagBaggage(&raw)
+	return raw, true
+}
+
+// reportOpenSpans records partial snapshots of the open spans.
+func (tracer *tracerImpl) reportOpenSpans() {
+	for _, raw := range tracer.openSpans.partialSpans() {
+		tracer.RecordSpan(raw)
+	}
+}
@@ -0,0 +1,137 @@
+package splunktracing
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+var _ = Describe("Open span tracking", func() {
+	var tracer *tracerImpl
+	var opts Options
+	var recorder *countingRecorder
+
+	BeforeEach(func() {
+		tracer = nil
+		recorder = &countingRecorder{}
+		opts = Options{Recorder: recorder, MinReportingPeriod: time.Hour, TrackOpenSpans: true}
+	})
+
+	AfterEach(func() {
+		if tracer != nil {
+			closeTestTracer(tracer)
+		}
+	})
+
+	It("lists open spans oldest first", func() {
+		tracer = newTestTracer(opts)
+		now := time.Now()
+		newer := tracer.StartSpan("newer", opentracing.StartTime(now.Add(-time.Second)))
+		older := tracer.StartSpan("older", opentracing.StartTime(now.Add(-time.Minute)))
+		tracer.StartSpan("finished").Finish()
+
+		open := OpenSpans(tracer)
+		Expect(open).To(HaveLen(2))
+		Expect(open[0].Operation).To(Equal("older"))
+		Expect(open[0].SpanID).To(Equal(older.Context().(SpanContext).SpanID))
+		Expect(open[0].Age).To(BeNumerically(">=", time.Minute))
+		Expect(open[1].Operation).To(Equal("newer"))
+
+		newer.Finish()
+		older.Finish()
+		Expect(OpenSpans(tracer)).To(BeEmpty())
+	})
+
+	It("reports no negative age for a start time in the future", func() {
+		tracer = newTestTracer(opts)
+		tracer.StartSpan("ahead", opentracing.StartTime(time.Now().Add(time.Minute)))
+
+		open := OpenSpans(tracer)
+		Expect(open).To(HaveLen(1))
+		Expect(open[0].Age).To(BeZero())
+	})
+
+	It("bounds the registry", func() {
+		opts.MaxOpenSpans = 1
+		tracer = newTestTracer(opts)
+		tracer.StartSpan("tracked")
+		tracer.StartSpan("untracked")
+		Expect(OpenSpans(tracer)).To(HaveLen(1))
+	})
+
+	It("reports open sampled spans as partial spans on demand and on close", func() {
+		tracer = newTestTracer(opts)
+		sp := tracer.StartSpan("leaked", opentracing.Tag{Key: "k", Value: "v"})
+		tracer.StartSpan("unsampled", opentracing.ChildOf(SpanContext{TraceID: 1, SpanID: 2}))
+
+		ReportOpenSpans(tracer)
+		Expect(recorder.Spans()).To(HaveLen(1))
+		partial := recorder.Spans()[0]
+		Expect(partial.Operation).To(Equal("leaked"))
+		Expect(partial.Incomplete).To(BeTrue())
+		Expect(partial.Duration).To(BeNumerically(">=", 0))
+		Expect(partial.Tags).To(Equal(opentracing.Tags{"k": "v"}))
+
+		// The span is still open, and reported again when it finishes.
+		sp.SetTag("k", "changed")
+		Expect(partial.Tags["k"]).To(Equal("v"))
+		Expect(OpenSpans(tracer)).To(HaveLen(2))
+
+		tracer.Close(context.Background())
+		Expect(recorder.Spans()).To(HaveLen(2))
+		Expect(recorder.Spans()[1].Incomplete).To(BeTrue())
+		Expect(recorder.Spans()[1].Tags["k"]).To(Equal("changed"))
+	})
+
+	It("reports the logs of partial spans in order, as on finish", func() {
+		opts.MaxLogsPerSpan = 3
+		tracer = newTestTracer(opts)
+		sp := tracer.StartSpan("op")
+		for i := 0; i < 4; i++ {
+			sp.LogFields(log.Int("i", i))
+		}
+
+		ReportOpenSpans(tracer)
+		sp.Finish()
+		Expect(recorder.Spans()).To(HaveLen(2))
+		partial, finished := recorder.Spans()[0], recorder.Spans()[1]
+		Expect(partial.Logs).To(Equal(finished.Logs))
+		Expect(partial.Logs[0].Fields).To(Equal([]log.Field{log.Int("i", 0)}))
+		Expect(partial.Logs[2].Fields).To(Equal([]log.Field{log.Int("i", 3)}))
+	})
+
+	It("tags partial spans with baggage items, as on finish", func() {
+		opts.BaggageTagKeys = []string{"tenant_id", "region"}
+		tracer = newTestTracer(opts)
+		sp := tracer.StartSpan("op", opentracing.Tag{Key: "region", Value: "us"})
+		sp.SetBaggageItem("tenant_id", "t-1")
+		sp.SetBaggageItem("region", "eu")
+
+		ReportOpenSpans(tracer)
+		sp.Finish()
+		Expect(recorder.Spans()).To(HaveLen(2))
+		partial, finished := recorder.Spans()[0], recorder.Spans()[1]
+		Expect(partial.Tags).To(Equal(opentracing.Tags{"tenant_id": "t-1", "region": "us"}))
+		Expect(partial.Tags).To(Equal(finished.Tags))
+	})
+
+	It("reports the incomplete flag to Splunk", func() {
+		converter := newHECConverter(Options{})
+		span := RawSpan{Context: SpanContext{TraceID: 1, SpanID: 2}, Operation: "op", Start: time.Now()}
+		Expect(hecEvents(converter.toSpan(span, &reportBuffer{}, nil))[0]).NotTo(HaveKey("incomplete"))
+
+		span.Incomplete = true
+		Expect(hecEvents(converter.toSpan(span, &reportBuffer{}, nil))[0]).To(HaveKeyWithValue("incomplete", true))
+	})
+
+	It("tracks nothing by default", func() {
+		opts.TrackOpenSpans = false
+		tracer = newTestTracer(opts)
+		tracer.StartSpan("op")
+		Expect(OpenSpans(tracer)).To(BeEmpty())
+	})
+})
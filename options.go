@@ -5,7 +5,6 @@ import (
 	"math"
 	"math/rand"
 	"os"
-	"path"
 	"strings"
 	"time" // N.B.(jmacd): Do not use google.golang.org/glog in this package.
 
@@ -29,7 +28,17 @@ const (
 	DefaultMaxLogValueLen = 1024
 	DefaultMaxLogsPerSpan = 500
 
+	DefaultMaxTagsPerSpan = 1000
+	DefaultMaxTagKeyLen   = 256
+	DefaultMaxTagValueLen = 1024
+
 	DefaultMaxCallSendMsgSizeBytes = math.MaxInt32
+
+	DefaultMaxBaggageEntries    = 64
+	DefaultMaxBaggageEntryBytes = 4096
+	DefaultMaxBaggageBytes      = 8192
+
+	DefaultMaxOpenSpans = 10000
 )
 
 // Tag and Tracer Attribute keys.
@@ -51,6 +60,22 @@ const (
 	plaintextScheme = "http"
 )
 
+// LogLayout selects how span logs are reported, see Options.LogLayout.
+type LogLayout string
+
+// Log layouts.
+const (
+	// LogLayoutSeparate reports each log as a splunktracing:log event that
+	// repeats every field of its span event but the timing.
+	LogLayoutSeparate LogLayout = "separate"
+	// LogLayoutTrimmed reports each log as a splunktracing:log event with
+	// only its timestamp, fields, and the trace, span and parent span IDs.
+	LogLayoutTrimmed LogLayout = "trimmed"
+	// LogLayoutEmbedded reports the logs as an ordered "logs" array of the
+	// span event, each with its timestamp and fields, and no log events.
+	LogLayoutEmbedded LogLayout = "embedded"
+)
+
 // Validation Errors
 var (
 	errInvalidGUIDKey = fmt.Errorf("Options invalid: setting the %v tag is no longer supported", GUIDKey)
@@ -119,6 +144,18 @@ type Options struct {
 	// this Tracer.
 	Tags opentracing.Tags
 
+	// Resource identifies the service and process, and is reported apart
+	// from the span tags. See Resource for how it relates to the
+	// ComponentNameKey and HostnameKey tags.
+	Resource Resource `yaml:"resource" json:"resource"`
+
+	// LegacyTracerAttributes reports the tracer attributes (Tags plus the
+	// tracer_* keys) in their layout from before Resource, for existing
+	// searches: the tracer_* keys, ComponentNameKey and HostnameKey at the
+	// top level of span events, and the other Tags merged into "tags". By
+	// default they are only reported in "resource".
+	LegacyTracerAttributes bool `yaml:"legacy_tracer_attributes" json:"legacy_tracer_attributes"`
+
 	// Splunk is the host, port, and plaintext option to use
 	// for the Splunk HEC API.
 	SplunkAPI Endpoint `yaml:"splunk_hec_api"`
@@ -139,6 +176,57 @@ type Options struct {
 	// MaxLogsPerSpan limits the number of logs in a single span.
 	MaxLogsPerSpan int `yaml:"max_logs_per_span"`
 
+	// LogLayout selects how span logs are reported to Splunk. Defaults to
+	// LogLayoutSeparate; LogLayoutTrimmed and LogLayoutEmbedded send fewer
+	// bytes.
+	LogLayout LogLayout `yaml:"log_layout" json:"log_layout"`
+
+	// MaxTagsPerSpan limits the number of tags on a single span. New tags
+	// beyond the limit are dropped and counted in the span's
+	// dropped_tags_count; existing tags may still be updated.
+	MaxTagsPerSpan int `yaml:"max_tags_per_span"`
+
+	// MaxTagKeyLen is the maximum allowable size (in characters) of a tag
+	// key. Longer keys are truncated.
+	MaxTagKeyLen int `yaml:"max_tag_key_len"`
+
+	// MaxTagValueLen is the maximum allowable size (in characters) of a tag
+	// value. Longer values are truncated. Only applies to string values.
+	MaxTagValueLen int `yaml:"max_tag_value_len"`
+
+	// MaxBaggageEntries limits the number of baggage items a span may carry.
+	// Items beyond the limit are dropped, both when set and when extracted.
+	MaxBaggageEntries int `yaml:"max_baggage_entries"`
+
+	// MaxBaggageEntryBytes limits the size in bytes of a single baggage item,
+	// counted as its key and value. Larger items are dropped.
+	MaxBaggageEntryBytes int `yaml:"max_baggage_entry_bytes"`
+
+	// MaxBaggageBytes limits the combined size in bytes of all baggage items
+	// on a span. Items that would exceed it are dropped.
+	MaxBaggageBytes int `yaml:"max_baggage_bytes"`
+
+	// UseW3CBaggage injects baggage as a single W3C `baggage` header instead
+	// of one `ot-baggage-*` header per item. Both forms are always accepted
+	// on extract. The properties of W3C baggage members, e.g. ";ttl=30", are
+	// kept with their items and injected again with UseW3CBaggage.
+	UseW3CBaggage bool `yaml:"use_w3c_baggage"`
+
+	// BaggageAllowlist, if not empty, lists the only baggage keys spans may
+	// carry, exactly or as path.Match globs, ignoring case. Other items are
+	// dropped, both when set and when extracted.
+	BaggageAllowlist []string `yaml:"baggage_allowlist"`
+
+	// BaggageDenylist lists baggage keys, like BaggageAllowlist, whose items
+	// are dropped even if the allowlist lets them through.
+	BaggageDenylist []string `yaml:"baggage_denylist"`
+
+	// BaggageTagKeys lists baggage keys whose items are copied into the tags
+	// of the spans carrying them when they finish, e.g. "tenant_id", unless
+	// the span has a tag with the same key already. Baggage keys match
+	// ignoring case, and the tag is set under the key listed here.
+	BaggageTagKeys []string `yaml:"baggage_tag_keys"`
+
 	// GRPCMaxCallSendMsgSizeBytes limits the size in bytes of grpc messages
 	// sent by a client.
 	MaxCallSendMsgSizeBytes int `yaml:"max_call_send_msg_size_bytes"`
@@ -173,11 +261,60 @@ type Options struct {
 	// A hook for receiving finished span events
 	Recorder SpanRecorder `yaml:"-" json:"-"`
 
+	// SpanProcessors are run, in order, on every span: OnStart as it starts
+	// and, if it is sampled, OnFinish as it finishes. A processor may enrich
+	// a span or drop it, which hides it from the processors after it, from
+	// Splunk and from the Recorder. Reporting to Splunk runs after the last
+	// processor, and the Recorder after that.
+	SpanProcessors []SpanProcessor `yaml:"-" json:"-"`
+
+	// TrackOpenSpans keeps a registry of the spans that have started but
+	// not finished, to find spans that are never finished. See OpenSpans.
+	// Tracer.Close, and ReportOpenSpans on demand, report the sampled ones
+	// as partial spans, with incomplete set and their duration so far.
+	TrackOpenSpans bool `yaml:"track_open_spans" json:"track_open_spans"`
+
+	// MaxOpenSpans bounds the registry of TrackOpenSpans. Spans started
+	// while it is full are not tracked. Defaults to DefaultMaxOpenSpans.
+	MaxOpenSpans int `yaml:"max_open_spans" json:"max_open_spans"`
+
+	// Redaction, if set, masks, hashes or drops sensitive data in operation
+	// names, tags, log fields and baggage, after the SpanProcessors and
+	// before spans are reported or recorded. See RedactionOptions.
+	Redaction *RedactionOptions `yaml:"redaction"`
+
+	// Sampler decides whether new traces are recorded. If nil, every trace
+	// is recorded. See NewProbabilisticSampler, and NewAdaptiveSampler for a
+	// sampler that adjusts its rate to a throughput budget.
+	Sampler Sampler `yaml:"-" json:"-"`
+
+	// RemoteSampling, if set, polls a sampling strategy document and
+	// samples new traces according to the last good one. Sampler applies
+	// until the first document is fetched.
+	RemoteSampling *RemoteSamplingOptions `yaml:"remote_sampling"`
+
+	// TailSampling, if set, enables a stage that holds finished spans by
+	// trace and reports or drops each local trace as a whole. See
+	// TailSamplingOptions. The Recorder still receives every finished span.
+	TailSampling *TailSamplingOptions `yaml:"tail_sampling"`
+
+	// Propagators are used alongside the default ot-tracer-* headers for the
+	// opentracing.TextMap and opentracing.HTTPHeaders formats. Inject writes
+	// every format; Extract tries the default headers first, then each
+	// propagator in order, and uses the first span context found. See
+	// XRayPropagator, B3Propagator and W3CTraceContextPropagator.
+	Propagators []Propagator `yaml:"-" json:"-"`
+
 	// For testing purposes only
 	ConnFactory ConnectorFactory `yaml:"-" json:"-"`
 
 	// Enable Splunk Meta Event Logging
 	MetaEventReportingEnabled bool `yaml:"meta_event_reporting_enabled" json:"meta_event_reporting_enabled"`
+
+	// Use128BitTraceID makes new root spans start 128-bit traces, as used by
+	// W3C and OpenTelemetry peers. Spans continuing an extracted trace keep
+	// the width of the incoming ID.
+	Use128BitTraceID bool `yaml:"use_128bit_trace_id" json:"use_128bit_trace_id"`
 }
 
 // Initialize validates options, and sets default values for unset options.
@@ -201,6 +338,30 @@ func (opts *Options) Initialize() error {
 	if opts.MaxLogsPerSpan == 0 {
 		opts.MaxLogsPerSpan = DefaultMaxLogsPerSpan
 	}
+	if opts.LogLayout == "" {
+		opts.LogLayout = LogLayoutSeparate
+	}
+	if opts.MaxTagsPerSpan == 0 {
+		opts.MaxTagsPerSpan = DefaultMaxTagsPerSpan
+	}
+	if opts.MaxTagKeyLen == 0 {
+		opts.MaxTagKeyLen = DefaultMaxTagKeyLen
+	}
+	if opts.MaxTagValueLen == 0 {
+		opts.MaxTagValueLen = DefaultMaxTagValueLen
+	}
+	if opts.MaxBaggageEntries == 0 {
+		opts.MaxBaggageEntries = DefaultMaxBaggageEntries
+	}
+	if opts.MaxBaggageEntryBytes == 0 {
+		opts.MaxBaggageEntryBytes = DefaultMaxBaggageEntryBytes
+	}
+	if opts.MaxBaggageBytes == 0 {
+		opts.MaxBaggageBytes = DefaultMaxBaggageBytes
+	}
+	if opts.MaxOpenSpans == 0 {
+		opts.MaxOpenSpans = DefaultMaxOpenSpans
+	}
 	if opts.MaxCallSendMsgSizeBytes == 0 {
 		opts.MaxCallSendMsgSizeBytes = DefaultMaxCallSendMsgSizeBytes
 	}
@@ -221,13 +382,7 @@ func (opts *Options) Initialize() error {
 	}
 
 	// Set some default attributes if not found in options
-	if _, found := opts.Tags[ComponentNameKey]; !found {
-		opts.Tags[ComponentNameKey] = path.Base(os.Args[0])
-	}
-	if _, found := opts.Tags[HostnameKey]; !found {
-		hostname, _ := os.Hostname()
-		opts.Tags[HostnameKey] = hostname
-	}
+	opts.Resource.setDefaults(opts.Tags)
 	if _, found := opts.Tags[CommandLineKey]; !found {
 		opts.Tags[CommandLineKey] = strings.Join(os.Args, " ")
 	}
@@ -255,6 +410,20 @@ func (opts *Options) Validate() error {
 	if _, found := opts.Tags[GUIDKey]; found {
 		return errInvalidGUIDKey
 	}
+	if err := opts.Resource.validate(opts.Tags); err != nil {
+		return err
+	}
+	if err := validateBaggageKeyPatterns("BaggageAllowlist", opts.BaggageAllowlist); err != nil {
+		return err
+	}
+	if err := validateBaggageKeyPatterns("BaggageDenylist", opts.BaggageDenylist); err != nil {
+		return err
+	}
+	switch opts.LogLayout {
+	case "", LogLayoutSeparate, LogLayoutTrimmed, LogLayoutEmbedded:
+	default:
+		return fmt.Errorf("Options invalid: unknown LogLayout %q", opts.LogLayout)
+	}
 
 	if len(opts.Collector.CustomCACertFile) != 0 {
 		if _, err := os.Stat(opts.Collector.CustomCACertFile); os.IsNotExist(err) {
@@ -288,6 +457,17 @@ func (sid SetTraceID) applySPL(sso *startSpanOptions) {
 	sso.SetTraceID = uint64(sid)
 }
 
+// SetTraceIDHigh is an opentracing.StartSpanOption that sets the
+// upper 64 bits of an explicit 128-bit TraceID.  It must be used
+// in conjunction with SetTraceID or the result is undefined.
+type SetTraceIDHigh uint64
+
+// Apply satisfies the StartSpanOption interface.
+func (sid SetTraceIDHigh) Apply(sso *opentracing.StartSpanOptions) {}
+func (sid SetTraceIDHigh) applySPL(sso *startSpanOptions) {
+	sso.SetTraceIDHigh = uint64(sid)
+}
+
 // SetParentSpanID is an opentracing.StartSpanOption that sets
 // an explicit parent SpanID.  It must be used in conjunction
 // with SetTraceID or the result is undefined.  If the value
@@ -302,6 +482,27 @@ func (sid SetParentSpanID) applySPL(sso *startSpanOptions) {
 	sso.SetParentSpanID = uint64(sid)
 }
 
+// WithLink returns an opentracing.StartSpanOption that links the span to
+// the span of sc, which usually belongs to another trace, without making it
+// the parent. It may be given several times. Contexts from other tracers are
+// ignored.
+func WithLink(sc opentracing.SpanContext, attributes opentracing.Tags) opentracing.StartSpanOption {
+	return spanLinkOption{context: sc, attributes: attributes}
+}
+
+type spanLinkOption struct {
+	context    opentracing.SpanContext
+	attributes opentracing.Tags
+}
+
+// Apply satisfies the StartSpanOption interface.
+func (o spanLinkOption) Apply(sso *opentracing.StartSpanOptions) {}
+func (o spanLinkOption) applySPL(sso *startSpanOptions) {
+	if link, ok := newSpanLink(o.context, o.attributes); ok {
+		sso.Links = append(sso.Links, link)
+	}
+}
+
 // splunkStartSpanOption is used to identify splunk-specific Span options.
 type splunkStartSpanOption interface {
 	applySPL(*startSpanOptions)
@@ -316,6 +517,10 @@ type startSpanOptions struct {
 	SetSpanID       uint64
 	SetParentSpanID uint64
 	SetTraceID      uint64
+	SetTraceIDHigh  uint64
+
+	// Links set with WithLink.
+	Links []SpanLink
 }
 
 func newStartSpanOptions(sso []opentracing.StartSpanOption) startSpanOptions {
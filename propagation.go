@@ -0,0 +1,59 @@
+package splunktracing
+
+import (
+	"github.com/opentracing/opentracing-go"
+)
+
+// Propagator injects a SpanContext into, and extracts one from, a carrier
+// of the opentracing.TextMap or opentracing.HTTPHeaders formats.
+type Propagator interface {
+	Inject(opentracing.SpanContext, interface{}) error
+	Extract(interface{}) (opentracing.SpanContext, error)
+}
+
+// propagatorChain injects with every propagator in turn, and extracts with
+// the first one that finds a span context in the carrier. A context that only
+// requests debugging, without a trace, does not stop the search; its debug
+// flag is carried over to a context found later.
+type propagatorChain []Propagator
+
+func (c propagatorChain) Inject(sc opentracing.SpanContext, carrier interface{}) error {
+	for _, p := range c {
+		if err := p.Inject(sc, carrier); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c propagatorChain) Extract(carrier interface{}) (opentracing.SpanContext, error) {
+	var debugOnly *SpanContext
+	for _, p := range c {
+		sc, err := p.Extract(carrier)
+		if err == opentracing.ErrSpanContextNotFound {
+			continue
+		}
+		if err != nil {
+			return sc, err
+		}
+		ctx, ok := sc.(SpanContext)
+		if !ok {
+			return sc, nil
+		}
+		if ctx.TraceID == 0 && ctx.Debug {
+			if debugOnly == nil {
+				debugOnly = &ctx
+			}
+			continue
+		}
+		if debugOnly != nil {
+			ctx.Debug = true
+			ctx.Sampled = true
+		}
+		return ctx, nil
+	}
+	if debugOnly != nil {
+		return *debugOnly, nil
+	}
+	return nil, opentracing.ErrSpanContextNotFound
+}
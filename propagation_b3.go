@@ -0,0 +1,108 @@
+package splunktracing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+const (
+	b3TraceIDHeader = "X-B3-TraceId"
+	b3SpanIDHeader  = "X-B3-SpanId"
+	b3SampledHeader = "X-B3-Sampled"
+	b3FlagsHeader   = "X-B3-Flags"
+)
+
+// B3Propagator propagates span contexts in the Zipkin B3 multi-header
+// format: X-B3-TraceId (16 or 32 hex digits), X-B3-SpanId, X-B3-Sampled and
+// X-B3-Flags. A debug trace is injected with X-B3-Flags: 1, which implies
+// sampling, instead of X-B3-Sampled. A carrier with only X-B3-Flags: 1
+// extracts to a context that starts a new debug trace. Add it to
+// Options.Propagators to use it alongside the default headers.
+type B3Propagator struct{}
+
+// Inject satisfies the Propagator interface.
+func (B3Propagator) Inject(spanContext opentracing.SpanContext, opaqueCarrier interface{}) error {
+	sc, ok := spanContext.(SpanContext)
+	if !ok {
+		return opentracing.ErrInvalidSpanContext
+	}
+	carrier, ok := opaqueCarrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	// B3 IDs are fixed-width: 16 hex digits, or 32 for 128-bit trace IDs.
+	traceID := fmt.Sprintf("%016x", sc.TraceID)
+	if sc.TraceIDHigh != 0 {
+		traceID = traceIDToHex(sc.TraceIDHigh, sc.TraceID)
+	}
+	carrier.Set(b3TraceIDHeader, traceID)
+	carrier.Set(b3SpanIDHeader, fmt.Sprintf("%016x", sc.SpanID))
+	if sc.Debug {
+		carrier.Set(b3FlagsHeader, "1")
+	} else if sc.Sampled {
+		carrier.Set(b3SampledHeader, "1")
+	} else {
+		carrier.Set(b3SampledHeader, "0")
+	}
+	return nil
+}
+
+// Extract satisfies the Propagator interface. A missing X-B3-Sampled header
+// counts as sampled.
+func (B3Propagator) Extract(opaqueCarrier interface{}) (opentracing.SpanContext, error) {
+	carrier, ok := opaqueCarrier.(opentracing.TextMapReader)
+	if !ok {
+		return nil, opentracing.ErrInvalidCarrier
+	}
+
+	sc := SpanContext{Sampled: true}
+	var foundTraceID, foundSpanID bool
+	err := carrier.ForeachKey(func(k, v string) error {
+		var err error
+		switch {
+		case strings.EqualFold(k, b3TraceIDHeader):
+			if len(v) != 16 && len(v) != 32 {
+				return opentracing.ErrSpanContextCorrupted
+			}
+			sc.TraceIDHigh, sc.TraceID, err = hexToTraceID(v)
+			foundTraceID = true
+		case strings.EqualFold(k, b3SpanIDHeader):
+			sc.SpanID, err = strconv.ParseUint(v, 16, 64)
+			foundSpanID = true
+		case strings.EqualFold(k, b3SampledHeader):
+			switch v {
+			case "1", "true":
+				sc.Sampled = true
+			case "0", "false":
+				sc.Sampled = false
+			default:
+				return opentracing.ErrSpanContextCorrupted
+			}
+		case strings.EqualFold(k, b3FlagsHeader):
+			sc.Debug = v == "1"
+		}
+		if err != nil {
+			return opentracing.ErrSpanContextCorrupted
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sc.Debug {
+		sc.Sampled = true
+	}
+	if !foundTraceID && !foundSpanID {
+		if sc.Debug {
+			return SpanContext{Sampled: true, Debug: true}, nil
+		}
+		return nil, opentracing.ErrSpanContextNotFound
+	}
+	if !foundTraceID || !foundSpanID {
+		return nil, opentracing.ErrSpanContextCorrupted
+	}
+	return sc, nil
+}
@@ -0,0 +1,102 @@
+package splunktracing
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+)
+
+var _ = Describe("B3Propagator", func() {
+	var propagator B3Propagator
+
+	It("round-trips 64-bit and 128-bit span contexts", func() {
+		for _, sc := range []SpanContext{
+			{TraceID: 0xabc, SpanID: 0xdef, Sampled: true},
+			{TraceID: 1, TraceIDHigh: 2, SpanID: 3},
+		} {
+			carrier := opentracing.HTTPHeadersCarrier(http.Header{})
+			Expect(propagator.Inject(sc, carrier)).To(Succeed())
+			extracted, err := propagator.Extract(carrier)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(extracted).To(Equal(sc))
+		}
+	})
+
+	It("injects fixed-width IDs", func() {
+		out := opentracing.TextMapCarrier{}
+		Expect(propagator.Inject(SpanContext{TraceID: 0xabc, SpanID: 1, Sampled: true}, out)).To(Succeed())
+		Expect(out).To(Equal(opentracing.TextMapCarrier{
+			b3TraceIDHeader: "0000000000000abc",
+			b3SpanIDHeader:  "0000000000000001",
+			b3SampledHeader: "1",
+		}))
+	})
+
+	It("propagates debug traces with X-B3-Flags", func() {
+		out := opentracing.TextMapCarrier{}
+		Expect(propagator.Inject(SpanContext{TraceID: 1, SpanID: 2, Sampled: true, Debug: true}, out)).To(Succeed())
+		Expect(out).To(HaveKeyWithValue(b3FlagsHeader, "1"))
+		Expect(out).NotTo(HaveKey(b3SampledHeader))
+
+		extracted, err := propagator.Extract(out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extracted.(SpanContext).Debug).To(BeTrue())
+		Expect(extracted.(SpanContext).Sampled).To(BeTrue())
+	})
+
+	It("treats a missing sampling decision as sampled", func() {
+		extracted, err := propagator.Extract(opentracing.TextMapCarrier{
+			"x-b3-traceid": "0000000000000001",
+			"x-b3-spanid":  "2",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extracted.(SpanContext).Sampled).To(BeTrue())
+	})
+
+	It("extracts a debug request without a trace", func() {
+		extracted, err := propagator.Extract(opentracing.TextMapCarrier{b3FlagsHeader: "1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extracted).To(Equal(SpanContext{Sampled: true, Debug: true}))
+	})
+
+	It("reports missing and malformed headers", func() {
+		_, err := propagator.Extract(opentracing.TextMapCarrier{})
+		Expect(err).To(Equal(opentracing.ErrSpanContextNotFound))
+
+		for _, carrier := range []opentracing.TextMapCarrier{
+			{b3TraceIDHeader: "0000000000000001"},
+			{b3TraceIDHeader: "1", b3SpanIDHeader: "2"},
+			{b3TraceIDHeader: "000000000000000g", b3SpanIDHeader: "2"},
+			{b3TraceIDHeader: "0000000000000001", b3SpanIDHeader: "2", b3SampledHeader: "maybe"},
+		} {
+			_, err := propagator.Extract(carrier)
+			Expect(err).To(Equal(opentracing.ErrSpanContextCorrupted))
+		}
+	})
+
+	Context("registered in Options.Propagators", func() {
+		var tracer *tracerImpl
+
+		BeforeEach(func() {
+			tracer = newTestTracer(Options{Propagators: []Propagator{B3Propagator{}}})
+		})
+
+		AfterEach(func() {
+			closeTestTracer(tracer)
+		})
+
+		It("carries a jaeger-debug-id request over to a B3 trace", func() {
+			carrier := opentracing.TextMapCarrier{
+				fieldNameJaegerDebugID: "abc",
+				b3TraceIDHeader:        "0000000000000001",
+				b3SpanIDHeader:         "2",
+				b3SampledHeader:        "0",
+			}
+			extracted, err := tracer.Extract(opentracing.TextMap, carrier)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(extracted).To(Equal(SpanContext{TraceID: 1, SpanID: 2, Sampled: true, Debug: true}))
+		})
+	})
+})
@@ -0,0 +1,301 @@
+package splunktracing
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+const fieldNameBaggage = "baggage"
+
+// Reasons reported by EventBaggageDropped.
+var (
+	errBaggageEntryTooLarge  = errors.New("baggage item exceeds MaxBaggageEntryBytes")
+	errBaggageTooManyEntries = errors.New("baggage exceeds MaxBaggageEntries")
+	errBaggageTooLarge       = errors.New("baggage exceeds MaxBaggageBytes")
+	errBaggageMalformed      = errors.New("malformed W3C baggage list member")
+	errBaggageKeyNotAllowed  = errors.New("baggage key is not allowed by BaggageAllowlist or BaggageDenylist")
+	errBaggageKeyNotToken    = errors.New("baggage key is not a valid W3C baggage key")
+)
+
+// baggageLimits bounds the baggage carried by a span. A zero limit is
+// unbounded.
+type baggageLimits struct {
+	maxEntries    int
+	maxEntryBytes int
+	maxBytes      int
+
+	// lower-cased patterns of Options.BaggageAllowlist and BaggageDenylist
+	allowlist []string
+	denylist  []string
+}
+
+func newBaggageLimits(opts Options) baggageLimits {
+	return baggageLimits{
+		maxEntries:    opts.MaxBaggageEntries,
+		maxEntryBytes: opts.MaxBaggageEntryBytes,
+		maxBytes:      opts.MaxBaggageBytes,
+		allowlist:     lowerAll(opts.BaggageAllowlist),
+		denylist:      lowerAll(opts.BaggageDenylist),
+	}
+}
+
+func lowerAll(patterns []string) []string {
+	if len(patterns) == 0 {
+		return nil
+	}
+	lowered := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		lowered[i] = strings.ToLower(pattern)
+	}
+	return lowered
+}
+
+// validateBaggageKeyPatterns checks the patterns of BaggageAllowlist or
+// BaggageDenylist.
+func validateBaggageKeyPatterns(option string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Options invalid: %v pattern %q: %v", option, pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesBaggageKey reports whether key matches one of the lower-cased
+// patterns, ignoring case.
+func matchesBaggageKey(patterns []string, key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether the allowlist and denylist let spans carry key.
+func (l baggageLimits) allows(key string) bool {
+	if len(l.allowlist) > 0 && !matchesBaggageKey(l.allowlist, key) {
+		return false
+	}
+	return !matchesBaggageKey(l.denylist, key)
+}
+
+// lookupBaggageItem returns the item of baggage whose key matches key,
+// ignoring case, since `ot-baggage-*` headers are lower-cased on extract. An
+// exact match takes precedence.
+func lookupBaggageItem(baggage map[string]string, key string) (string, bool) {
+	if val, found := baggage[key]; found {
+		return val, true
+	}
+	for k, val := range baggage {
+		if strings.EqualFold(k, key) {
+			return val, true
+		}
+	}
+	return "", false
+}
+
+func baggageEntrySize(key, val string) int {
+	return len(key) + len(val)
+}
+
+// baggagePropertiesSize is the size of the properties of a W3C baggage item
+// as they are injected, which counts towards the item's size.
+func baggagePropertiesSize(properties []string) int {
+	size := 0
+	for _, property := range properties {
+		size += 1 + len(property)
+	}
+	return size
+}
+
+// fits reports why an item of key and size cannot be added to baggage that
+// already holds count items totalling bytes, or nil if it can.
+func (l baggageLimits) fits(count, bytes int, key string, size int) error {
+	switch {
+	case !l.allows(key):
+		return errBaggageKeyNotAllowed
+	case l.maxEntryBytes > 0 && size > l.maxEntryBytes:
+		return errBaggageEntryTooLarge
+	case l.maxEntries > 0 && count+1 > l.maxEntries:
+		return errBaggageTooManyEntries
+	case l.maxBytes > 0 && bytes+size > l.maxBytes:
+		return errBaggageTooLarge
+	}
+	return nil
+}
+
+// check reports why key=val cannot be set on baggage, or nil if it can. An
+// existing item with the same key is replaced rather than added to.
+func (l baggageLimits) check(baggage map[string]string, key, val string) error {
+	count, bytes := 0, 0
+	for k, v := range baggage {
+		if k == key {
+			continue
+		}
+		count++
+		bytes += baggageEntrySize(k, v)
+	}
+	return l.fits(count, bytes, key, baggageEntrySize(key, val))
+}
+
+// baggageAccumulator collects extracted baggage items and the properties of
+// W3C items, dropping the items that are malformed or over the limits.
+type baggageAccumulator struct {
+	limits     baggageLimits
+	baggage    map[string]string
+	properties map[string][]string // initialized on first use
+	bytes      int
+	dropped    int
+	reason     error
+}
+
+func newBaggageAccumulator(limits baggageLimits) *baggageAccumulator {
+	return &baggageAccumulator{
+		limits:  limits,
+		baggage: map[string]string{},
+	}
+}
+
+// add adds an item, replacing any item with the same key along with its
+// properties.
+func (a *baggageAccumulator) add(key, val string, properties []string) {
+	count, bytes := len(a.baggage), a.bytes
+	if old, found := a.baggage[key]; found {
+		count--
+		bytes -= baggageEntrySize(key, old) + baggagePropertiesSize(a.properties[key])
+	}
+	size := baggageEntrySize(key, val) + baggagePropertiesSize(properties)
+	if err := a.limits.fits(count, bytes, key, size); err != nil {
+		a.drop(err)
+		return
+	}
+	a.baggage[key] = val
+	a.bytes = bytes + size
+	if len(properties) > 0 {
+		if a.properties == nil {
+			a.properties = map[string][]string{}
+		}
+		a.properties[key] = properties
+	} else {
+		delete(a.properties, key)
+	}
+}
+
+func (a *baggageAccumulator) drop(reason error) {
+	a.dropped++
+	if a.reason == nil {
+		a.reason = reason
+	}
+}
+
+// report emits a single EventBaggageDropped covering every dropped item.
+func (a *baggageAccumulator) report() {
+	if a.dropped > 0 {
+		emitEvent(newEventBaggageDropped(a.dropped, a.reason))
+	}
+}
+
+// baggageMember is a single list member of a W3C baggage header.
+// Properties are kept verbatim, e.g. "ttl=30" or "opaque".
+type baggageMember struct {
+	key        string
+	value      string
+	properties []string
+}
+
+// decodeW3CBaggage parses a W3C baggage header, percent-decoding values. It
+// returns the well-formed members and the number of malformed ones skipped.
+func decodeW3CBaggage(header string) (members []baggageMember, malformed int) {
+	for _, raw := range strings.Split(header, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		parts := strings.Split(raw, ";")
+		kv := strings.SplitN(parts[0], "=", 2)
+		if len(kv) != 2 {
+			malformed++
+			continue
+		}
+		key := strings.TrimSpace(kv[0])
+		value, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+		if !isBaggageKey(key) || err != nil {
+			malformed++
+			continue
+		}
+		member := baggageMember{key: key, value: value}
+		for _, property := range parts[1:] {
+			if property = strings.TrimSpace(property); property != "" {
+				member.properties = append(member.properties, property)
+			}
+		}
+		members = append(members, member)
+	}
+	return members, malformed
+}
+
+// encodeW3CBaggage formats baggage as a W3C baggage header, sorted by key,
+// with the properties of each item. Items whose keys are not valid header
+// tokens cannot be represented; they are left out, and counted in dropped.
+func encodeW3CBaggage(baggage map[string]string, properties map[string][]string) (header string, dropped int) {
+	keys := make([]string, 0, len(baggage))
+	for k := range baggage {
+		if isBaggageKey(k) {
+			keys = append(keys, k)
+		} else {
+			dropped++
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		escapeBaggageValue(&b, baggage[k])
+		for _, property := range properties[k] {
+			b.WriteByte(';')
+			b.WriteString(property)
+		}
+	}
+	return b.String(), dropped
+}
+
+// escapeBaggageValue percent-encodes every byte outside the W3C
+// baggage-octet range, plus '%' itself so the value decodes unambiguously.
+func escapeBaggageValue(b *strings.Builder, value string) {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c > 0x20 && c < 0x7f && c != '"' && c != ',' && c != ';' && c != '\\' && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(b, "%%%02X", c)
+	}
+}
+
+// isBaggageKey reports whether key is an RFC 7230 token.
+func isBaggageKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,284 @@
+package splunktracing
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+)
+
+var _ = Describe("W3C baggage", func() {
+	Describe("decodeW3CBaggage", func() {
+		It("decodes percent-encoded values and keeps properties", func() {
+			members, malformed := decodeW3CBaggage("userId=alice, serverNode=DF%2028;ttl=30;opaque ,isProduction=false")
+			Expect(malformed).To(BeZero())
+			Expect(members).To(Equal([]baggageMember{
+				{key: "userId", value: "alice"},
+				{key: "serverNode", value: "DF 28", properties: []string{"ttl=30", "opaque"}},
+				{key: "isProduction", value: "false"},
+			}))
+		})
+
+		It("skips malformed members", func() {
+			members, malformed := decodeW3CBaggage("novalue,bad key=1,ok=1,broken=%zz")
+			Expect(malformed).To(Equal(3))
+			Expect(members).To(Equal([]baggageMember{{key: "ok", value: "1"}}))
+		})
+	})
+
+	Describe("encodeW3CBaggage", func() {
+		It("sorts keys and escapes values", func() {
+			header, dropped := encodeW3CBaggage(map[string]string{
+				"b": "x,y;z",
+				"a": "50% off",
+			}, map[string][]string{"b": {"ttl=30", "opaque"}})
+			Expect(header).To(Equal("a=50%25%20off,b=x%2Cy%3Bz;ttl=30;opaque"))
+			Expect(dropped).To(BeZero())
+		})
+
+		It("round-trips through decodeW3CBaggage", func() {
+			baggage := map[string]string{"k": "ünïcode \"quoted\"\\"}
+			header, _ := encodeW3CBaggage(baggage, nil)
+			members, malformed := decodeW3CBaggage(header)
+			Expect(malformed).To(BeZero())
+			Expect(members).To(Equal([]baggageMember{{key: "k", value: baggage["k"]}}))
+		})
+
+		It("leaves out keys that are not tokens", func() {
+			header, dropped := encodeW3CBaggage(map[string]string{"bad key": "v", "ok": "v"}, nil)
+			Expect(header).To(Equal("ok=v"))
+			Expect(dropped).To(Equal(1))
+		})
+	})
+})
+
+var _ = Describe("baggage limits", func() {
+	var events <-chan Event
+	var carrier opentracing.TextMapCarrier
+	var propagator textMapPropagator
+
+	BeforeEach(func() {
+		var handler EventHandler
+		handler, events = NewEventChannel(10)
+		SetGlobalEventHandler(handler)
+
+		carrier = opentracing.TextMapCarrier{
+			fieldNameTraceID: "1",
+			fieldNameSpanID:  "2",
+			fieldNameSampled: "true",
+		}
+		propagator = textMapPropagator{
+			baggageLimits: baggageLimits{maxEntries: 2, maxEntryBytes: 8, maxBytes: 12},
+		}
+	})
+
+	extract := func() map[string]string {
+		sc, err := propagator.Extract(carrier)
+		Expect(err).NotTo(HaveOccurred())
+		return sc.(SpanContext).Baggage
+	}
+
+	It("accepts baggage within the limits", func() {
+		carrier.Set(fieldNameBaggage, "a=1,b=2")
+		Expect(extract()).To(Equal(map[string]string{"a": "1", "b": "2"}))
+		Expect(events).NotTo(Receive())
+	})
+
+	It("drops items beyond the entry count", func() {
+		carrier.Set(fieldNameBaggage, "a=1,b=2,c=3")
+		Expect(extract()).To(HaveLen(2))
+
+		var event Event
+		Expect(events).To(Receive(&event))
+		Expect(event.(EventBaggageDropped).DroppedItems()).To(Equal(1))
+		Expect(event.(EventBaggageDropped).Err().Error()).To(ContainSubstring("MaxBaggageEntries"))
+	})
+
+	It("drops oversized items", func() {
+		carrier.Set(prefixBaggage+"big", strings.Repeat("x", 8))
+		carrier.Set(prefixBaggage+"ok", "1")
+		Expect(extract()).To(Equal(map[string]string{"ok": "1"}))
+
+		var event Event
+		Expect(events).To(Receive(&event))
+		Expect(event.(EventBaggageDropped).Err().Error()).To(ContainSubstring("MaxBaggageEntryBytes"))
+	})
+
+	It("drops items that exceed the total size", func() {
+		carrier.Set(fieldNameBaggage, "a=123456,b=123456")
+		Expect(extract()).To(HaveLen(1))
+
+		var event Event
+		Expect(events).To(Receive(&event))
+		Expect(event.(EventBaggageDropped).Err().Error()).To(ContainSubstring("MaxBaggageBytes"))
+	})
+
+	It("counts malformed members as dropped", func() {
+		carrier.Set(fieldNameBaggage, "a=1,oops")
+		Expect(extract()).To(HaveLen(1))
+
+		var event Event
+		Expect(events).To(Receive(&event))
+		Expect(event.(EventBaggageDropped).DroppedItems()).To(Equal(1))
+	})
+
+	Context("on SetBaggageItem", func() {
+		var tracer *tracerImpl
+
+		BeforeEach(func() {
+			tracer = newTestTracer(Options{MaxBaggageEntries: 1})
+		})
+
+		AfterEach(func() {
+			closeTestTracer(tracer)
+		})
+
+		It("rejects items beyond the limits", func() {
+			sp := tracer.StartSpan("op")
+			sp.SetBaggageItem("a", "1")
+			sp.SetBaggageItem("b", "2")
+			Expect(sp.BaggageItem("a")).To(Equal("1"))
+			Expect(sp.BaggageItem("b")).To(BeEmpty())
+			Eventually(events).Should(Receive(BeAssignableToTypeOf(&eventBaggageDropped{})))
+		})
+
+		It("allows replacing an existing item", func() {
+			sp := tracer.StartSpan("op")
+			sp.SetBaggageItem("a", "1")
+			sp.SetBaggageItem("a", "2")
+			Expect(sp.BaggageItem("a")).To(Equal("2"))
+		})
+	})
+
+	Context("with an allowlist and a denylist", func() {
+		BeforeEach(func() {
+			propagator.baggageLimits = newBaggageLimits(Options{
+				BaggageAllowlist: []string{"tenant_id", "User_*"},
+				BaggageDenylist:  []string{"user_email"},
+			})
+		})
+
+		It("drops extracted items that are not allowed", func() {
+			carrier.Set(prefixBaggage+"tenant_id", "acme")
+			carrier.Set(prefixBaggage+"user_tier", "gold")
+			carrier.Set(prefixBaggage+"user_email", "ann@example.com")
+			carrier.Set(prefixBaggage+"debug", "1")
+			Expect(extract()).To(Equal(map[string]string{"tenant_id": "acme", "user_tier": "gold"}))
+
+			var event Event
+			Expect(events).To(Receive(&event))
+			Expect(event.(EventBaggageDropped).DroppedItems()).To(Equal(2))
+			Expect(event.(EventBaggageDropped).Err().Error()).To(ContainSubstring("BaggageAllowlist"))
+		})
+
+		It("rejects items that are not allowed on SetBaggageItem", func() {
+			tracer := newTestTracer(Options{BaggageDenylist: []string{"secret*"}})
+			defer closeTestTracer(tracer)
+
+			sp := tracer.StartSpan("op")
+			sp.SetBaggageItem("Secret_Token", "x")
+			sp.SetBaggageItem("tenant_id", "acme")
+			Expect(sp.Context().(SpanContext).Baggage).To(Equal(map[string]string{"tenant_id": "acme"}))
+			Eventually(events).Should(Receive(BeAssignableToTypeOf(&eventBaggageDropped{})))
+		})
+
+		It("rejects malformed patterns", func() {
+			opts := Options{BaggageAllowlist: []string{"["}}
+			Expect(opts.Initialize()).NotTo(Succeed())
+		})
+	})
+
+	Context("with BaggageTagKeys", func() {
+		It("copies baggage items into the tags of finished spans", func() {
+			recorder := &countingRecorder{}
+			tracer := newTestTracer(Options{Recorder: recorder, BaggageTagKeys: []string{"tenant_id", "user_tier", "region"}})
+			defer closeTestTracer(tracer)
+
+			parent := SpanContext{TraceID: 1, SpanID: 2, Sampled: true, Baggage: map[string]string{"tenant_id": "acme"}}
+			sp := tracer.StartSpan("op", opentracing.ChildOf(parent))
+			sp.SetBaggageItem("user_tier", "gold")
+			sp.SetBaggageItem("other", "x")
+			sp.SetTag("tenant_id", "explicit")
+			sp.Finish()
+
+			Expect(recorder.Spans()[0].Tags).To(Equal(opentracing.Tags{"tenant_id": "explicit", "user_tier": "gold"}))
+		})
+
+		It("matches baggage keys ignoring case", func() {
+			recorder := &countingRecorder{}
+			tracer := newTestTracer(Options{Recorder: recorder, BaggageTagKeys: []string{"tenantId"}})
+			defer closeTestTracer(tracer)
+
+			parent, err := tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier{
+				fieldNameTraceID:           "1",
+				fieldNameSpanID:            "2",
+				fieldNameSampled:           "true",
+				prefixBaggage + "TenantId": "acme",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			tracer.StartSpan("op", opentracing.ChildOf(parent)).Finish()
+
+			Expect(recorder.Spans()[0].Tags).To(Equal(opentracing.Tags{"tenantId": "acme"}))
+		})
+	})
+
+	Context("with UseW3CBaggage", func() {
+		BeforeEach(func() {
+			propagator.useW3CBaggage = true
+		})
+
+		It("injects a single baggage header", func() {
+			out := opentracing.TextMapCarrier{}
+			sc := SpanContext{TraceID: 1, SpanID: 2, Baggage: map[string]string{"a": "x y"}}
+			Expect(propagator.Inject(sc, out)).To(Succeed())
+			Expect(out[fieldNameBaggage]).To(Equal("a=x%20y"))
+			Expect(out).NotTo(HaveKey(prefixBaggage + "a"))
+		})
+
+		It("reports items it cannot inject, and skips an empty header", func() {
+			out := opentracing.TextMapCarrier{}
+			sc := SpanContext{TraceID: 1, SpanID: 2, Baggage: map[string]string{"bad key": "v"}}
+			Expect(propagator.Inject(sc, out)).To(Succeed())
+			Expect(out).NotTo(HaveKey(fieldNameBaggage))
+
+			var event Event
+			Expect(events).To(Receive(&event))
+			Expect(event.(EventBaggageDropped).DroppedItems()).To(Equal(1))
+			Expect(event.(EventBaggageDropped).Err().Error()).To(ContainSubstring(errBaggageKeyNotToken.Error()))
+		})
+
+		It("forwards the properties of extracted items", func() {
+			carrier.Set(fieldNameBaggage, "a=1;t=3;o,b=2")
+			sc, err := propagator.Extract(carrier)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sc.(SpanContext).Baggage).To(Equal(map[string]string{"a": "1", "b": "2"}))
+			Expect(sc.(SpanContext).BaggageProperties).To(Equal(map[string][]string{"a": {"t=3", "o"}}))
+
+			out := opentracing.TextMapCarrier{}
+			Expect(propagator.Inject(sc, out)).To(Succeed())
+			Expect(out[fieldNameBaggage]).To(Equal("a=1;t=3;o,b=2"))
+		})
+
+		It("keeps properties through child spans until the item is set again", func() {
+			tracer := newTestTracer(Options{UseW3CBaggage: true})
+			defer closeTestTracer(tracer)
+			carrier.Set(fieldNameBaggage, "a=1;ttl=30,b=2;opaque")
+			parent, err := tracer.Extract(opentracing.TextMap, carrier)
+			Expect(err).NotTo(HaveOccurred())
+
+			child := tracer.StartSpan("child", opentracing.ChildOf(parent))
+			child.SetBaggageItem("b", "3")
+			out := opentracing.TextMapCarrier{}
+			Expect(tracer.Inject(child.Context(), opentracing.TextMap, out)).To(Succeed())
+			Expect(out[fieldNameBaggage]).To(Equal("a=1;ttl=30,b=3"))
+			Expect(parent.(SpanContext).BaggageProperties).To(HaveKey("b"))
+		})
+
+		It("counts properties towards the size limits", func() {
+			carrier.Set(fieldNameBaggage, "a=1;ttl=30000")
+			Expect(extract()).To(BeEmpty())
+			Expect(events).To(Receive())
+		})
+	})
+})
@@ -0,0 +1,67 @@
+package splunktracing
+
+import (
+	"google.golang.org/grpc/metadata"
+)
+
+// GRPCMetadataCarrier satisfies both opentracing.TextMapWriter and
+// opentracing.TextMapReader for gRPC metadata, so it can be passed to Inject
+// and Extract with the opentracing.TextMap or opentracing.HTTPHeaders formats.
+//
+// On the client, inject into a copy of the outgoing metadata and attach it
+// with metadata.NewOutgoingContext; on the server, extract from the
+// metadata.FromIncomingContext result.
+type GRPCMetadataCarrier metadata.MD
+
+// Set satisfies opentracing.TextMapWriter. gRPC metadata keys are lowercase,
+// so the key is lowercased.
+func (c GRPCMetadataCarrier) Set(key, val string) {
+	metadata.MD(c).Set(key, val)
+}
+
+// ForeachKey satisfies opentracing.TextMapReader. Keys with several values
+// are visited once per value.
+func (c GRPCMetadataCarrier) ForeachKey(handler func(key, val string) error) error {
+	for k, vals := range c {
+		for _, v := range vals {
+			if err := handler(k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MessageHeader is a single message header, in the key/value shape used by
+// Kafka-style message queue clients.
+type MessageHeader struct {
+	Key   string
+	Value []byte
+}
+
+// MessageHeadersCarrier satisfies both opentracing.TextMapWriter and
+// opentracing.TextMapReader for a list of message headers. Pass a pointer to
+// Inject so that new headers can be appended.
+type MessageHeadersCarrier []MessageHeader
+
+// Set satisfies opentracing.TextMapWriter. It replaces the first header with
+// the same key, or appends a new one.
+func (c *MessageHeadersCarrier) Set(key, val string) {
+	for i := range *c {
+		if (*c)[i].Key == key {
+			(*c)[i].Value = []byte(val)
+			return
+		}
+	}
+	*c = append(*c, MessageHeader{Key: key, Value: []byte(val)})
+}
+
+// ForeachKey satisfies opentracing.TextMapReader.
+func (c MessageHeadersCarrier) ForeachKey(handler func(key, val string) error) error {
+	for _, h := range c {
+		if err := handler(h.Key, string(h.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package splunktracing
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+	"google.golang.org/grpc/metadata"
+)
+
+var _ = Describe("Carriers", func() {
+	var tracer *tracerImpl
+	var parent opentracing.Span
+
+	BeforeEach(func() {
+		tracer = newTestTracer(Options{})
+		parent = tracer.StartSpan("parent")
+		parent.SetBaggageItem("tenant", "acme")
+	})
+
+	AfterEach(func() {
+		closeTestTracer(tracer)
+	})
+
+	expectSameTrace := func(extracted opentracing.SpanContext) {
+		want := parent.Context().(SpanContext)
+		got := extracted.(SpanContext)
+		Expect(got.TraceID).To(Equal(want.TraceID))
+		Expect(got.SpanID).To(Equal(want.SpanID))
+		Expect(got.Baggage).To(HaveKeyWithValue("tenant", "acme"))
+	}
+
+	Describe("GRPCMetadataCarrier", func() {
+		It("round-trips a span context", func() {
+			md := metadata.MD{}
+			Expect(tracer.Inject(parent.Context(), opentracing.HTTPHeaders, GRPCMetadataCarrier(md))).To(Succeed())
+			Expect(md.Get(fieldNameTraceID)).To(HaveLen(1))
+
+			extracted, err := tracer.Extract(opentracing.HTTPHeaders, GRPCMetadataCarrier(md))
+			Expect(err).NotTo(HaveOccurred())
+			expectSameTrace(extracted)
+		})
+
+		It("lowercases keys", func() {
+			md := metadata.MD{}
+			GRPCMetadataCarrier(md).Set("X-Mixed-Case", "v")
+			Expect(md).To(HaveKey("x-mixed-case"))
+		})
+	})
+
+	Describe("MessageHeadersCarrier", func() {
+		It("round-trips a span context", func() {
+			headers := MessageHeadersCarrier{{Key: "content-type", Value: []byte("json")}}
+			Expect(tracer.Inject(parent.Context(), opentracing.TextMap, &headers)).To(Succeed())
+			Expect(headers[0]).To(Equal(MessageHeader{Key: "content-type", Value: []byte("json")}))
+
+			extracted, err := tracer.Extract(opentracing.TextMap, headers)
+			Expect(err).NotTo(HaveOccurred())
+			expectSameTrace(extracted)
+		})
+
+		It("replaces existing headers instead of duplicating them", func() {
+			headers := MessageHeadersCarrier{}
+			headers.Set("k", "1")
+			headers.Set("k", "2")
+			Expect(headers).To(Equal(MessageHeadersCarrier{{Key: "k", Value: []byte("2")}}))
+		})
+	})
+})
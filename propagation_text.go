@@ -1,6 +1,7 @@
 package splunktracing
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 
@@ -15,13 +16,34 @@ const (
 	fieldNameTraceID      = prefixTracerState + "traceid"
 	fieldNameSpanID       = prefixTracerState + "spanid"
 	fieldNameSampled      = prefixTracerState + "sampled"
+
+	// fieldNameDebug is optional, and only injected for debug traces.
+	fieldNameDebug = prefixTracerState + "debug"
+
+	// The optional sampling fields carry SpanContext.Sampling, so that
+	// downstream spans report the same sample weight.
+	fieldNameSamplerType  = prefixTracerState + "samplertype"
+	fieldNameSamplerParam = prefixTracerState + "samplerparam"
+	fieldNameSampleWeight = prefixTracerState + "sampleweight"
+
+	// fieldNameJaegerDebugID lets a client force a new trace into sampling,
+	// as with Jaeger clients.
+	fieldNameJaegerDebugID = "jaeger-debug-id"
 )
 
-var theTextMapPropagator textMapPropagator
+type textMapPropagator struct {
+	baggageLimits baggageLimits
+	useW3CBaggage bool
+}
 
-type textMapPropagator struct{}
+func newTextMapPropagator(opts Options) textMapPropagator {
+	return textMapPropagator{
+		baggageLimits: newBaggageLimits(opts),
+		useW3CBaggage: opts.UseW3CBaggage,
+	}
+}
 
-func (textMapPropagator) Inject(
+func (p textMapPropagator) Inject(
 	spanContext opentracing.SpanContext,
 	opaqueCarrier interface{},
 ) error {
@@ -33,17 +55,37 @@ func (textMapPropagator) Inject(
 	if !ok {
 		return opentracing.ErrInvalidCarrier
 	}
-	carrier.Set(fieldNameTraceID, strconv.FormatUint(sc.TraceID, 16))
+	carrier.Set(fieldNameTraceID, sc.TraceIDHex())
 	carrier.Set(fieldNameSpanID, strconv.FormatUint(sc.SpanID, 16))
-	carrier.Set(fieldNameSampled, "true")
+	carrier.Set(fieldNameSampled, strconv.FormatBool(sc.Sampled))
+	if sc.Debug {
+		carrier.Set(fieldNameDebug, strconv.FormatBool(sc.Debug))
+	}
+	if sc.Sampling.SamplerType != "" {
+		carrier.Set(fieldNameSamplerType, sc.Sampling.SamplerType)
+		carrier.Set(fieldNameSamplerParam, fmt.Sprint(sc.Sampling.SamplerParam))
+	}
+	if sc.Sampling.Weight != 0 {
+		carrier.Set(fieldNameSampleWeight, strconv.FormatFloat(sc.Sampling.Weight, 'g', -1, 64))
+	}
 
+	if p.useW3CBaggage {
+		header, dropped := encodeW3CBaggage(sc.Baggage, sc.BaggageProperties)
+		if dropped > 0 {
+			emitEvent(newEventBaggageDropped(dropped, errBaggageKeyNotToken))
+		}
+		if header != "" {
+			carrier.Set(fieldNameBaggage, header)
+		}
+		return nil
+	}
 	for k, v := range sc.Baggage {
 		carrier.Set(prefixBaggage+k, v)
 	}
 	return nil
 }
 
-func (textMapPropagator) Extract(
+func (p textMapPropagator) Extract(
 	opaqueCarrier interface{},
 ) (opentracing.SpanContext, error) {
 	carrier, ok := opaqueCarrier.(opentracing.TextMapReader)
@@ -52,13 +94,16 @@ func (textMapPropagator) Extract(
 	}
 
 	requiredFieldCount := 0
-	var traceID, spanID uint64
+	var traceIDHigh, traceID, spanID uint64
+	var sampled, debug bool
+	var sampling SamplingInfo
 	var err error
-	decodedBaggage := map[string]string{}
+	decodedBaggage := newBaggageAccumulator(p.baggageLimits)
 	err = carrier.ForeachKey(func(k, v string) error {
 		switch strings.ToLower(k) {
 		case fieldNameTraceID:
-			traceID, err = strconv.ParseUint(v, 16, 64)
+			// Accepts both 64-bit and 128-bit trace IDs.
+			traceIDHigh, traceID, err = hexToTraceID(v)
 			if err != nil {
 				return opentracing.ErrSpanContextCorrupted
 			}
@@ -70,11 +115,39 @@ func (textMapPropagator) Extract(
 			}
 			requiredFieldCount++
 		case fieldNameSampled:
+			sampled, err = strconv.ParseBool(v)
+			if err != nil {
+				return opentracing.ErrSpanContextCorrupted
+			}
 			requiredFieldCount++
+		case fieldNameDebug:
+			debug, err = strconv.ParseBool(v)
+			if err != nil {
+				return opentracing.ErrSpanContextCorrupted
+			}
+		case fieldNameJaegerDebugID:
+			debug = v != ""
+		case fieldNameSamplerType:
+			sampling.SamplerType = v
+		case fieldNameSamplerParam:
+			sampling.SamplerParam = parseSamplerParam(v)
+		case fieldNameSampleWeight:
+			sampling.Weight, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				return opentracing.ErrSpanContextCorrupted
+			}
 		default:
 			lowercaseK := strings.ToLower(k)
 			if strings.HasPrefix(lowercaseK, prefixBaggage) {
-				decodedBaggage[strings.TrimPrefix(lowercaseK, prefixBaggage)] = v
+				decodedBaggage.add(strings.TrimPrefix(lowercaseK, prefixBaggage), v, nil)
+			} else if lowercaseK == fieldNameBaggage {
+				members, malformed := decodeW3CBaggage(v)
+				for i := 0; i < malformed; i++ {
+					decodedBaggage.drop(errBaggageMalformed)
+				}
+				for _, m := range members {
+					decodedBaggage.add(m.key, m.value, m.properties)
+				}
 			}
 		}
 		return nil
@@ -83,15 +156,38 @@ func (textMapPropagator) Extract(
 		return nil, err
 	}
 	if requiredFieldCount < tracerStateFieldCount {
-		if requiredFieldCount == 0 {
+		if requiredFieldCount != 0 {
+			return nil, opentracing.ErrSpanContextCorrupted
+		}
+		if !debug {
 			return nil, opentracing.ErrSpanContextNotFound
 		}
-		return nil, opentracing.ErrSpanContextCorrupted
+		// A debug request without a trace: spans started from the returned
+		// context are debug roots.
 	}
+	decodedBaggage.report()
 
 	return SpanContext{
-		TraceID: traceID,
-		SpanID:  spanID,
-		Baggage: decodedBaggage,
+		TraceID:     traceID,
+		TraceIDHigh: traceIDHigh,
+		SpanID:      spanID,
+		Sampled:     sampled || debug,
+		Debug:       debug,
+		Sampling:    sampling,
+		Baggage:     decodedBaggage.baggage,
+
+		BaggageProperties: decodedBaggage.properties,
 	}, nil
 }
+
+// parseSamplerParam restores the type of a propagated sampler.param: a
+// number for rates, a bool for const samplers.
+func parseSamplerParam(v string) interface{} {
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(v); err == nil {
+		return b
+	}
+	return v
+}
@@ -0,0 +1,124 @@
+package splunktracing
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+)
+
+var _ = Describe("textMapPropagator", func() {
+	var propagator textMapPropagator
+	var carrier opentracing.TextMapCarrier
+
+	BeforeEach(func() {
+		propagator = textMapPropagator{}
+		carrier = opentracing.TextMapCarrier{}
+	})
+
+	Context("with a 128-bit trace ID", func() {
+		sc := SpanContext{
+			TraceID:     0x0123456789abcdef,
+			TraceIDHigh: 0xfedcba9876543210,
+			SpanID:      0x42,
+		}
+
+		It("injects 32 hex characters", func() {
+			Expect(propagator.Inject(sc, carrier)).To(Succeed())
+			Expect(carrier[fieldNameTraceID]).To(Equal("fedcba98765432100123456789abcdef"))
+		})
+
+		It("round-trips both halves", func() {
+			Expect(propagator.Inject(sc, carrier)).To(Succeed())
+			extracted, err := propagator.Extract(carrier)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(extracted.(SpanContext).TraceIDHigh).To(Equal(sc.TraceIDHigh))
+			Expect(extracted.(SpanContext).TraceID).To(Equal(sc.TraceID))
+			Expect(extracted.(SpanContext).SpanID).To(Equal(sc.SpanID))
+		})
+
+		It("accepts IDs without leading zeros", func() {
+			carrier.Set(fieldNameTraceID, "1000000000000000a")
+			carrier.Set(fieldNameSpanID, "1")
+			carrier.Set(fieldNameSampled, "true")
+			extracted, err := propagator.Extract(carrier)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(extracted.(SpanContext).TraceIDHigh).To(Equal(uint64(1)))
+			Expect(extracted.(SpanContext).TraceID).To(Equal(uint64(0xa)))
+		})
+	})
+
+	Context("with a 64-bit trace ID from an older peer", func() {
+		BeforeEach(func() {
+			carrier.Set(fieldNameTraceID, "abc")
+			carrier.Set(fieldNameSpanID, "def")
+			carrier.Set(fieldNameSampled, "true")
+		})
+
+		It("extracts the ID unchanged", func() {
+			extracted, err := propagator.Extract(carrier)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(extracted.(SpanContext).TraceIDHigh).To(BeZero())
+			Expect(extracted.(SpanContext).TraceID).To(Equal(uint64(0xabc)))
+		})
+
+		It("re-injects the ID in the 64-bit form", func() {
+			extracted, _ := propagator.Extract(carrier)
+			out := opentracing.TextMapCarrier{}
+			Expect(propagator.Inject(extracted, out)).To(Succeed())
+			Expect(out[fieldNameTraceID]).To(Equal("abc"))
+		})
+	})
+
+	Describe("the sampled flag", func() {
+		It("carries an unsampled decision", func() {
+			sc := SpanContext{TraceID: 1, SpanID: 2, Sampled: false}
+			Expect(propagator.Inject(sc, carrier)).To(Succeed())
+			Expect(carrier[fieldNameSampled]).To(Equal("false"))
+
+			extracted, err := propagator.Extract(carrier)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(extracted.(SpanContext).Sampled).To(BeFalse())
+		})
+
+		It("carries a sampled decision", func() {
+			sc := SpanContext{TraceID: 1, SpanID: 2, Sampled: true}
+			Expect(propagator.Inject(sc, carrier)).To(Succeed())
+
+			extracted, err := propagator.Extract(carrier)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(extracted.(SpanContext).Sampled).To(BeTrue())
+		})
+
+		It("rejects values that are not booleans", func() {
+			carrier.Set(fieldNameTraceID, "1")
+			carrier.Set(fieldNameSpanID, "2")
+			carrier.Set(fieldNameSampled, "maybe")
+			_, err := propagator.Extract(carrier)
+			Expect(err).To(Equal(opentracing.ErrSpanContextCorrupted))
+		})
+
+		It("carries the sampler and sample weight", func() {
+			for _, sampling := range []SamplingInfo{
+				{SamplerType: SamplerTypeProbabilistic, SamplerParam: 0.25, Weight: 4},
+				{SamplerType: SamplerTypeConst, SamplerParam: true, Weight: 1},
+				{},
+			} {
+				carrier := opentracing.TextMapCarrier{}
+				sc := SpanContext{TraceID: 1, SpanID: 2, Sampled: true, Sampling: sampling}
+				Expect(propagator.Inject(sc, carrier)).To(Succeed())
+
+				extracted, err := propagator.Extract(carrier)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(extracted.(SpanContext).Sampling).To(Equal(sampling))
+			}
+		})
+	})
+
+	It("rejects trace IDs longer than 128 bits", func() {
+		carrier.Set(fieldNameTraceID, "1fedcba98765432100123456789abcdef")
+		carrier.Set(fieldNameSpanID, "1")
+		carrier.Set(fieldNameSampled, "true")
+		_, err := propagator.Extract(carrier)
+		Expect(err).To(Equal(opentracing.ErrSpanContextCorrupted))
+	})
+})
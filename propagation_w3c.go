@@ -0,0 +1,183 @@
+package splunktracing
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+const (
+	w3cTraceParentHeader = "traceparent"
+	w3cTraceStateHeader  = "tracestate"
+	w3cVersion           = "00"
+	w3cSampledFlag       = 0x01
+
+	// w3cTraceStateKey is this tracer's tracestate list member, whose value
+	// is a ';'-separated list of fields. "d:1" requests a debug trace.
+	w3cTraceStateKey   = "splunk"
+	w3cTraceStateDebug = "d:1"
+
+	w3cTraceStateMaxMembers = 32
+)
+
+// W3CTraceContextPropagator propagates span contexts in the W3C Trace Context
+// `traceparent` header, e.g.
+//
+//	00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+//
+// traceparent has no debug flag: a debug trace is injected as sampled, with
+// a `tracestate` entry of splunk=d:1 that carries the debug request to the
+// next service. The entry is merged into a tracestate header that the
+// carrier already holds, if it can be read. Add it to Options.Propagators to use it alongside the default
+// headers.
+type W3CTraceContextPropagator struct{}
+
+// Inject satisfies the Propagator interface.
+func (W3CTraceContextPropagator) Inject(spanContext opentracing.SpanContext, opaqueCarrier interface{}) error {
+	sc, ok := spanContext.(SpanContext)
+	if !ok {
+		return opentracing.ErrInvalidSpanContext
+	}
+	carrier, ok := opaqueCarrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	var flags byte
+	if sc.Sampled || sc.Debug {
+		flags |= w3cSampledFlag
+	}
+	carrier.Set(w3cTraceParentHeader, fmt.Sprintf("%s-%016x%016x-%016x-%02x",
+		w3cVersion, sc.TraceIDHigh, sc.TraceID, sc.SpanID, flags))
+	if sc.Debug {
+		var existing string
+		if reader, ok := opaqueCarrier.(opentracing.TextMapReader); ok {
+			existing = readHeader(reader, w3cTraceStateHeader)
+		}
+		// HTTPHeadersCarrier.Set adds a value rather than replacing it.
+		if headers, ok := opaqueCarrier.(opentracing.HTTPHeadersCarrier); ok {
+			http.Header(headers).Del(w3cTraceStateHeader)
+		}
+		carrier.Set(w3cTraceStateHeader, withTraceStateDebug(existing))
+	}
+	return nil
+}
+
+// readHeader returns the values of a header of the carrier, ignoring case,
+// joined by commas as a list header sent on several lines is.
+func readHeader(carrier opentracing.TextMapReader, name string) string {
+	var values []string
+	carrier.ForeachKey(func(k, v string) error {
+		if strings.EqualFold(k, name) {
+			values = append(values, v)
+		}
+		return nil
+	})
+	return strings.Join(values, ",")
+}
+
+// withTraceStateDebug puts this tracer's debug entry at the front of a
+// tracestate header, replacing its previous entry and keeping the other
+// vendors' entries, within the specification's 32 entries.
+func withTraceStateDebug(traceState string) string {
+	members := []string{w3cTraceStateKey + "=" + w3cTraceStateDebug}
+	for _, member := range strings.Split(traceState, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" || strings.HasPrefix(member, w3cTraceStateKey+"=") {
+			continue
+		}
+		if len(members) == w3cTraceStateMaxMembers {
+			break
+		}
+		members = append(members, member)
+	}
+	return strings.Join(members, ",")
+}
+
+// Extract satisfies the Propagator interface. Versions other than 00 are
+// parsed by their first four fields, as the specification requires.
+func (W3CTraceContextPropagator) Extract(opaqueCarrier interface{}) (opentracing.SpanContext, error) {
+	carrier, ok := opaqueCarrier.(opentracing.TextMapReader)
+	if !ok {
+		return nil, opentracing.ErrInvalidCarrier
+	}
+
+	var header, traceState string
+	err := carrier.ForeachKey(func(k, v string) error {
+		switch {
+		case strings.EqualFold(k, w3cTraceParentHeader):
+			header = v
+		case strings.EqualFold(k, w3cTraceStateHeader):
+			traceState = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if header == "" {
+		return nil, opentracing.ErrSpanContextNotFound
+	}
+	sc, err := parseTraceParent(strings.TrimSpace(header))
+	if err != nil {
+		return nil, err
+	}
+	if traceStateDebug(traceState) {
+		sc.Sampled = true
+		sc.Debug = true
+	}
+	return sc, nil
+}
+
+// traceStateDebug reports whether a tracestate header carries this tracer's
+// debug request.
+func traceStateDebug(traceState string) bool {
+	for _, member := range strings.Split(traceState, ",") {
+		kv := strings.SplitN(strings.TrimSpace(member), "=", 2)
+		if len(kv) != 2 || kv[0] != w3cTraceStateKey {
+			continue
+		}
+		for _, field := range strings.Split(kv[1], ";") {
+			if field == w3cTraceStateDebug {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseTraceParent parses a traceparent header of the form
+// {version}-{32 hex trace ID}-{16 hex parent ID}-{2 hex flags}.
+func parseTraceParent(header string) (SpanContext, error) {
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 ||
+		len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	if parts[0] == "ff" || (parts[0] == w3cVersion && len(parts) != 4) {
+		return SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	if _, err := strconv.ParseUint(parts[0], 16, 8); err != nil {
+		return SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	high, low, err := hexToTraceID(parts[1])
+	if err != nil || (high == 0 && low == 0) {
+		return SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	spanID, err := strconv.ParseUint(parts[2], 16, 64)
+	if err != nil || spanID == 0 {
+		return SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	return SpanContext{
+		TraceID:     low,
+		TraceIDHigh: high,
+		SpanID:      spanID,
+		Sampled:     flags&w3cSampledFlag != 0,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package splunktracing
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+)
+
+var _ = Describe("W3CTraceContextPropagator", func() {
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	var propagator W3CTraceContextPropagator
+
+	It("extracts a traceparent header", func() {
+		carrier := opentracing.HTTPHeadersCarrier(http.Header{})
+		carrier.Set(w3cTraceParentHeader, traceParent)
+
+		extracted, err := propagator.Extract(carrier)
+		Expect(err).NotTo(HaveOccurred())
+		sc := extracted.(SpanContext)
+		Expect(sc.TraceIDHex()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(sc.SpanID).To(Equal(uint64(0x00f067aa0ba902b7)))
+		Expect(sc.Sampled).To(BeTrue())
+	})
+
+	It("round-trips a span context", func() {
+		extracted, err := propagator.Extract(opentracing.TextMapCarrier{w3cTraceParentHeader: traceParent})
+		Expect(err).NotTo(HaveOccurred())
+
+		out := opentracing.TextMapCarrier{}
+		Expect(propagator.Inject(extracted, out)).To(Succeed())
+		Expect(out[w3cTraceParentHeader]).To(Equal(traceParent))
+	})
+
+	It("injects debug traces as sampled, with the debug request in tracestate", func() {
+		out := opentracing.TextMapCarrier{}
+		Expect(propagator.Inject(SpanContext{TraceID: 1, SpanID: 2, Debug: true}, out)).To(Succeed())
+		Expect(out[w3cTraceParentHeader]).To(Equal("00-00000000000000000000000000000001-0000000000000002-01"))
+		Expect(out[w3cTraceStateHeader]).To(Equal("splunk=d:1"))
+
+		extracted, err := propagator.Extract(out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extracted.(SpanContext).Debug).To(BeTrue())
+		Expect(extracted.(SpanContext).Sampled).To(BeTrue())
+
+		out = opentracing.TextMapCarrier{}
+		Expect(propagator.Inject(SpanContext{TraceID: 1, SpanID: 2, Sampled: true}, out)).To(Succeed())
+		Expect(out).NotTo(HaveKey(w3cTraceStateHeader))
+	})
+
+	It("merges the debug request into an existing tracestate header", func() {
+		carrier := opentracing.HTTPHeadersCarrier(http.Header{})
+		carrier.Set(w3cTraceStateHeader, "congo=t61rcWkgMzE,splunk=x:2")
+		carrier.Set(w3cTraceStateHeader, " rojo=00f067aa0ba902b7")
+		Expect(propagator.Inject(SpanContext{TraceID: 1, SpanID: 2, Debug: true}, carrier)).To(Succeed())
+		Expect(http.Header(carrier)[http.CanonicalHeaderKey(w3cTraceStateHeader)]).To(ConsistOf("splunk=d:1,congo=t61rcWkgMzE,rojo=00f067aa0ba902b7"))
+
+		full := make([]string, 32)
+		for i := range full {
+			full[i] = fmt.Sprintf("v%d=x", i)
+		}
+		out := opentracing.TextMapCarrier{w3cTraceStateHeader: strings.Join(full, ",")}
+		Expect(propagator.Inject(SpanContext{TraceID: 1, SpanID: 2, Debug: true}, out)).To(Succeed())
+		Expect(out[w3cTraceStateHeader]).To(Equal("splunk=d:1," + strings.Join(full[:31], ",")))
+	})
+
+	It("extracts the debug request from among other tracestate entries", func() {
+		carrier := opentracing.HTTPHeadersCarrier(http.Header{})
+		carrier.Set(w3cTraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		carrier.Set(w3cTraceStateHeader, "congo=t61rcWkgMzE, splunk=x:2;d:1")
+
+		extracted, err := propagator.Extract(carrier)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extracted.(SpanContext).Debug).To(BeTrue())
+		Expect(extracted.(SpanContext).Sampled).To(BeTrue())
+
+		for _, traceState := range []string{"congo=d:1", "splunk=d:0", "splunk"} {
+			extracted, err := propagator.Extract(opentracing.TextMapCarrier{
+				w3cTraceParentHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+				w3cTraceStateHeader:  traceState,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(extracted.(SpanContext).Debug).To(BeFalse(), traceState)
+		}
+	})
+
+	It("accepts future versions with extra fields", func() {
+		extracted, err := propagator.Extract(opentracing.TextMapCarrier{
+			w3cTraceParentHeader: "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extracted.(SpanContext).Sampled).To(BeFalse())
+	})
+
+	It("reports missing and malformed headers", func() {
+		_, err := propagator.Extract(opentracing.TextMapCarrier{})
+		Expect(err).To(Equal(opentracing.ErrSpanContextNotFound))
+
+		for _, header := range []string{
+			"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		} {
+			_, err := propagator.Extract(opentracing.TextMapCarrier{w3cTraceParentHeader: header})
+			Expect(err).To(Equal(opentracing.ErrSpanContextCorrupted), header)
+		}
+	})
+})
@@ -0,0 +1,109 @@
+package splunktracing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+const (
+	xrayTraceHeader = "X-Amzn-Trace-Id"
+	xrayRootKey     = "Root"
+	xrayParentKey   = "Parent"
+	xraySampledKey  = "Sampled"
+	xrayVersion     = "1"
+)
+
+// XRayPropagator propagates span contexts in the AWS X-Ray
+// `X-Amzn-Trace-Id` header, e.g.
+//
+//	Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1
+//
+// The Root's 8 hex digit epoch and 24 hex digit random part together form a
+// 128-bit trace ID, so the trace_id reported to Splunk is the Root without its
+// version and dashes. A 64-bit trace ID is injected with a zero epoch. Add it
+// to Options.Propagators to use it alongside the default headers.
+type XRayPropagator struct{}
+
+// Inject satisfies the Propagator interface.
+func (XRayPropagator) Inject(spanContext opentracing.SpanContext, opaqueCarrier interface{}) error {
+	sc, ok := spanContext.(SpanContext)
+	if !ok {
+		return opentracing.ErrInvalidSpanContext
+	}
+	carrier, ok := opaqueCarrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	sampled := "0"
+	if sc.Sampled {
+		sampled = "1"
+	}
+	carrier.Set(xrayTraceHeader, fmt.Sprintf("%s=%s-%08x-%08x%016x;%s=%016x;%s=%s",
+		xrayRootKey, xrayVersion, sc.TraceIDHigh>>32, sc.TraceIDHigh&0xffffffff, sc.TraceID,
+		xrayParentKey, sc.SpanID,
+		xraySampledKey, sampled,
+	))
+	return nil
+}
+
+// Extract satisfies the Propagator interface. A header without a Parent, as
+// sent by a load balancer that starts the trace, yields a context with a zero
+// SpanID. A missing or deferred ("?") sampling decision counts as sampled.
+func (XRayPropagator) Extract(opaqueCarrier interface{}) (opentracing.SpanContext, error) {
+	carrier, ok := opaqueCarrier.(opentracing.TextMapReader)
+	if !ok {
+		return nil, opentracing.ErrInvalidCarrier
+	}
+
+	var header string
+	err := carrier.ForeachKey(func(k, v string) error {
+		if strings.EqualFold(k, xrayTraceHeader) {
+			header = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if header == "" {
+		return nil, opentracing.ErrSpanContextNotFound
+	}
+
+	sc := SpanContext{Sampled: true}
+	foundRoot := false
+	for _, field := range strings.Split(header, ";") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case xrayRootKey:
+			sc.TraceIDHigh, sc.TraceID, err = parseXRayRoot(kv[1])
+			foundRoot = true
+		case xrayParentKey:
+			sc.SpanID, err = strconv.ParseUint(kv[1], 16, 64)
+		case xraySampledKey:
+			sc.Sampled = kv[1] != "0"
+		}
+		if err != nil {
+			return nil, opentracing.ErrSpanContextCorrupted
+		}
+	}
+	if !foundRoot {
+		return nil, opentracing.ErrSpanContextCorrupted
+	}
+	return sc, nil
+}
+
+// parseXRayRoot maps a Root of the form 1-{8 hex epoch}-{24 hex random} onto
+// a 128-bit trace ID.
+func parseXRayRoot(root string) (high, low uint64, err error) {
+	parts := strings.Split(root, "-")
+	if len(parts) != 3 || parts[0] != xrayVersion || len(parts[1]) != 8 || len(parts[2]) != 24 {
+		return 0, 0, opentracing.ErrSpanContextCorrupted
+	}
+	return hexToTraceID(parts[1] + parts[2])
+}
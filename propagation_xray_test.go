@@ -0,0 +1,117 @@
+package splunktracing
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+)
+
+var _ = Describe("XRayPropagator", func() {
+	const albHeader = "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+	var propagator XRayPropagator
+
+	It("maps the Root onto a 128-bit trace ID", func() {
+		carrier := opentracing.HTTPHeadersCarrier(http.Header{})
+		carrier.Set(xrayTraceHeader, albHeader)
+
+		extracted, err := propagator.Extract(carrier)
+		Expect(err).NotTo(HaveOccurred())
+		sc := extracted.(SpanContext)
+		Expect(sc.TraceIDHex()).To(Equal("5759e988bd862e3fe1be46a994272793"))
+		Expect(sc.SpanID).To(Equal(uint64(0x53995c3f42cd8ad8)))
+		Expect(sc.Sampled).To(BeTrue())
+	})
+
+	It("round-trips a span context", func() {
+		carrier := opentracing.TextMapCarrier{}
+		carrier.Set(xrayTraceHeader, albHeader)
+		extracted, err := propagator.Extract(carrier)
+		Expect(err).NotTo(HaveOccurred())
+
+		out := opentracing.TextMapCarrier{}
+		Expect(propagator.Inject(extracted, out)).To(Succeed())
+		Expect(out[xrayTraceHeader]).To(Equal(albHeader))
+	})
+
+	It("injects 64-bit trace IDs with a zero epoch", func() {
+		out := opentracing.TextMapCarrier{}
+		Expect(propagator.Inject(SpanContext{TraceID: 0xabc, SpanID: 1}, out)).To(Succeed())
+		Expect(out[xrayTraceHeader]).To(Equal("Root=1-00000000-000000000000000000000abc;Parent=0000000000000001;Sampled=0"))
+	})
+
+	It("accepts a header without a Parent", func() {
+		carrier := opentracing.TextMapCarrier{"x-amzn-trace-id": "Root=1-5759e988-bd862e3fe1be46a994272793"}
+		extracted, err := propagator.Extract(carrier)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extracted.(SpanContext).SpanID).To(BeZero())
+		Expect(extracted.(SpanContext).Sampled).To(BeTrue())
+	})
+
+	It("honors an unsampled decision", func() {
+		carrier := opentracing.TextMapCarrier{xrayTraceHeader: "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=0"}
+		extracted, err := propagator.Extract(carrier)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extracted.(SpanContext).Sampled).To(BeFalse())
+	})
+
+	It("reports a missing header", func() {
+		_, err := propagator.Extract(opentracing.TextMapCarrier{})
+		Expect(err).To(Equal(opentracing.ErrSpanContextNotFound))
+	})
+
+	It("rejects malformed roots", func() {
+		for _, header := range []string{
+			"Parent=53995c3f42cd8ad8",
+			"Root=2-5759e988-bd862e3fe1be46a994272793",
+			"Root=1-5759e988-bd862e3f",
+			"Root=1-5759e988-bd862e3fe1be46a99427279z",
+		} {
+			_, err := propagator.Extract(opentracing.TextMapCarrier{xrayTraceHeader: header})
+			Expect(err).To(Equal(opentracing.ErrSpanContextCorrupted), header)
+		}
+	})
+
+	Context("registered in Options.Propagators", func() {
+		var tracer *tracerImpl
+
+		BeforeEach(func() {
+			tracer = newTestTracer(Options{Propagators: []Propagator{XRayPropagator{}}})
+		})
+
+		AfterEach(func() {
+			closeTestTracer(tracer)
+		})
+
+		It("injects alongside the default headers", func() {
+			out := opentracing.TextMapCarrier{}
+			sp := tracer.StartSpan("op")
+			Expect(tracer.Inject(sp.Context(), opentracing.TextMap, out)).To(Succeed())
+			Expect(out).To(HaveKey(fieldNameTraceID))
+			Expect(out).To(HaveKey(xrayTraceHeader))
+		})
+
+		It("falls back to the X-Ray header on extract", func() {
+			carrier := opentracing.TextMapCarrier{xrayTraceHeader: albHeader}
+			extracted, err := tracer.Extract(opentracing.TextMap, carrier)
+			Expect(err).NotTo(HaveOccurred())
+
+			child := tracer.StartSpan("op", opentracing.ChildOf(extracted)).(*spanImpl)
+			Expect(child.raw.Context.TraceIDHex()).To(Equal("5759e988bd862e3fe1be46a994272793"))
+			Expect(child.raw.ParentSpanID).To(Equal(uint64(0x53995c3f42cd8ad8)))
+		})
+
+		It("prefers the default headers when both are present", func() {
+			carrier := opentracing.TextMapCarrier{
+				xrayTraceHeader:  albHeader,
+				fieldNameTraceID: "1",
+				fieldNameSpanID:  "2",
+				fieldNameSampled: "true",
+			}
+			extracted, err := tracer.Extract(opentracing.TextMap, carrier)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(extracted.(SpanContext).TraceID).To(Equal(uint64(1)))
+		})
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
 )
 
 // RawSpan encapsulates all state associated with a (finished) Splunk Span.
@@ -16,6 +17,15 @@ type RawSpan struct {
 	// "parent"), or 0 if there is no parent.
 	ParentSpanID uint64
 
+	// Every ChildOf and FollowsFrom reference the span was started with, in
+	// order. The first one is the parent; the others may belong to other
+	// traces, e.g. the producers of a batch of messages.
+	References []SpanReference
+
+	// Spans this span is related to without being their child, typically in
+	// other traces. See WithLink and AddSpanLink.
+	Links []SpanLink
+
 	// The name of the "operation" this span is an instance of. (Called a "span
 	// name" in some implementations)
 	Operation string
@@ -25,24 +35,146 @@ type RawSpan struct {
 	Start    time.Time
 	Duration time.Duration
 
+	// How far an explicit finish time was before the start time, when they
+	// came from clocks that disagree. Duration is then clamped to zero.
+	ClockSkew time.Duration
+
+	// Whether this is a snapshot of a span that had not finished yet, see
+	// Options.TrackOpenSpans. Duration is then the time elapsed so far.
+	Incomplete bool
+
 	// Essentially an extension mechanism. Can be used for many purposes,
 	// not to be enumerated here.
 	Tags opentracing.Tags
 
+	// The number of tags dropped because of Options.MaxTagsPerSpan.
+	DroppedTagsCount int
+
 	// The span's "microlog".
 	Logs []opentracing.LogRecord
 }
 
+// copyRawSpan returns a copy of raw that shares none of its maps and slices,
+// so that one can be changed while the other is read.
+func copyRawSpan(raw RawSpan) RawSpan {
+	raw.Context.Baggage = copyBaggage(raw.Context.Baggage)
+	if raw.Context.BaggageProperties != nil {
+		properties := make(map[string][]string, len(raw.Context.BaggageProperties))
+		for key, value := range raw.Context.BaggageProperties {
+			properties[key] = append([]string(nil), value...)
+		}
+		raw.Context.BaggageProperties = properties
+	}
+	raw.References = append([]SpanReference(nil), raw.References...)
+	raw.Tags = copyTags(raw.Tags)
+	if raw.Links != nil {
+		links := make([]SpanLink, len(raw.Links))
+		for i, link := range raw.Links {
+			link.Attributes = copyTags(link.Attributes)
+			links[i] = link
+		}
+		raw.Links = links
+	}
+	if raw.Logs != nil {
+		logs := make([]opentracing.LogRecord, len(raw.Logs))
+		for i, record := range raw.Logs {
+			record.Fields = append([]log.Field(nil), record.Fields...)
+			logs[i] = record
+		}
+		raw.Logs = logs
+	}
+	return raw
+}
+
+func copyTags(tags opentracing.Tags) opentracing.Tags {
+	if tags == nil {
+		return nil
+	}
+	copied := make(opentracing.Tags, len(tags))
+	for key, value := range tags {
+		copied[key] = value
+	}
+	return copied
+}
+
+func copyBaggage(baggage map[string]string) map[string]string {
+	if baggage == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(baggage))
+	for key, value := range baggage {
+		copied[key] = value
+	}
+	return copied
+}
+
+// SpanReference is a reference from a span to another span.
+type SpanReference struct {
+	Type opentracing.SpanReferenceType
+
+	// The referenced span's trace ID and span ID.
+	TraceID     uint64
+	TraceIDHigh uint64
+	SpanID      uint64
+}
+
+// SpanLink relates a span to another span, e.g. one of the traces that a
+// batch job consumed or the earlier attempt of a retried task.
+type SpanLink struct {
+	// The linked span's trace ID and span ID.
+	TraceID     uint64
+	TraceIDHigh uint64
+	SpanID      uint64
+
+	// Attributes describe the link, e.g. why the spans are related.
+	Attributes opentracing.Tags
+}
+
+// newSpanLink links to the span of sc. It returns false if sc is not a
+// valid Splunk SpanContext.
+func newSpanLink(sc opentracing.SpanContext, attributes opentracing.Tags) (SpanLink, bool) {
+	ctx, ok := sc.(SpanContext)
+	if !ok || ctx.TraceID == 0 {
+		return SpanLink{}, false
+	}
+	return SpanLink{
+		TraceID:     ctx.TraceID,
+		TraceIDHigh: ctx.TraceIDHigh,
+		SpanID:      ctx.SpanID,
+		Attributes:  attributes,
+	}, true
+}
+
 // SpanContext holds Splunk-specific Span metadata.
 type SpanContext struct {
 	// A probabilistically unique identifier for a [multi-span] trace.
 	TraceID uint64
 
+	// The upper 64 bits of a 128-bit trace ID, or 0 for a 64-bit trace ID.
+	TraceIDHigh uint64
+
 	// A probabilistically unique identifier for a span.
 	SpanID uint64
 
+	// Whether the trace is sampled. Unsampled spans are not recorded, but
+	// still propagate the decision to their children and downstream peers.
+	Sampled bool
+
+	// Whether the trace was forced into sampling for debugging, e.g. by a
+	// positive sampling.priority tag. Debug traces are always sampled, and
+	// are kept by every sampler and by the tail-sampling stage.
+	Debug bool
+
+	// How the trace was sampled, shared by all of its spans.
+	Sampling SamplingInfo
+
 	// The span's associated baggage.
 	Baggage map[string]string // initialized on first use
+
+	// The properties of W3C baggage items, by key, e.g. "ttl=30". They are
+	// extracted and injected with Options.UseW3CBaggage, and reset when an
+	// item is set again.
+	BaggageProperties map[string][]string
 }
 
 // ForeachBaggageItem belongs to the opentracing.SpanContext interface
@@ -54,6 +186,12 @@ func (c SpanContext) ForeachBaggageItem(handler func(k, v string) bool) {
 	}
 }
 
+// TraceIDHex returns the trace ID as it is propagated and reported: 32 hex
+// characters for a 128-bit trace ID, or the unpadded 64-bit form otherwise.
+func (c SpanContext) TraceIDHex() string {
+	return traceIDToHex(c.TraceIDHigh, c.TraceID)
+}
+
 // WithBaggageItem returns an entirely new basictracer SpanContext with the
 // given key:value baggage pair set.
 func (c SpanContext) WithBaggageItem(key, val string) SpanContext {
@@ -67,6 +205,29 @@ func (c SpanContext) WithBaggageItem(key, val string) SpanContext {
 		}
 		newBaggage[key] = val
 	}
+	var newProperties map[string][]string
+	if _, found := c.BaggageProperties[key]; found {
+		newProperties = make(map[string][]string, len(c.BaggageProperties))
+		for k, v := range c.BaggageProperties {
+			if k != key {
+				newProperties[k] = v
+			}
+		}
+	} else {
+		newProperties = c.BaggageProperties
+	}
 	// Use positional parameters so the compiler will help catch new fields.
-	return SpanContext{c.TraceID, c.SpanID, newBaggage}
+	return SpanContext{c.TraceID, c.TraceIDHigh, c.SpanID, c.Sampled, c.Debug, c.Sampling, newBaggage, newProperties}
+}
+
+// SamplingInfo describes the head-sampling decision for a trace. It is set
+// when the root span is sampled, inherited by every span of the trace, and
+// reported with each span so that counts can be scaled back up.
+type SamplingInfo struct {
+	// The SamplerTypeTagKey and SamplerParamTagKey tags of the decision.
+	SamplerType  string
+	SamplerParam interface{}
+
+	// The decision's SamplingDecision.Weight. Zero is reported as 1.
+	Weight float64
 }
@@ -0,0 +1,530 @@
+package splunktracing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// RedactionAction is what a RedactionRule does to the data it matches.
+type RedactionAction string
+
+// Redaction actions.
+const (
+	// RedactionMask replaces the data with RedactionOptions.Mask.
+	RedactionMask RedactionAction = "mask"
+	// RedactionHash replaces the data with the hex HMAC-SHA256 of it, keyed
+	// with RedactionOptions.HashKey, so that equal values can still be
+	// correlated.
+	RedactionHash RedactionAction = "hash"
+	// RedactionDrop removes the tag, log field or baggage item altogether.
+	// Operation names cannot be dropped, and are masked instead.
+	RedactionDrop RedactionAction = "drop"
+)
+
+// Built-in detectors for RedactionRule.Detector.
+const (
+	// RedactionDetectorCreditCard finds card numbers of 13 to 19 digits,
+	// optionally separated by spaces or dashes, that pass the Luhn check.
+	RedactionDetectorCreditCard = "credit_card"
+	// RedactionDetectorBearerToken finds "Bearer <token>" credentials.
+	RedactionDetectorBearerToken = "bearer_token"
+	// RedactionDetectorEmail finds email addresses.
+	RedactionDetectorEmail = "email"
+)
+
+// DefaultRedactionMask replaces masked data.
+const DefaultRedactionMask = "[REDACTED]"
+
+// RedactionOptions configure the redaction stage, see Options.Redaction.
+type RedactionOptions struct {
+	// Rules are applied in order to every span.
+	Rules []RedactionRule `yaml:"rules"`
+
+	// HashKey keys the RedactionHash action. It is required if any rule
+	// hashes.
+	HashKey string `yaml:"hash_key"`
+
+	// Mask replaces the data of the RedactionMask action. Defaults to
+	// DefaultRedactionMask.
+	Mask string `yaml:"mask"`
+}
+
+// RedactionRule matches sensitive data in one of three ways; set exactly one
+// of Key, ValuePattern and Detector.
+type RedactionRule struct {
+	// Key matches the keys of tags, log fields and baggage items, exactly or
+	// as a path.Match glob, ignoring case. The whole value is redacted.
+	Key string `yaml:"key"`
+
+	// ValuePattern is a regular expression matched against string values
+	// and operation names, and against the text of numbers, errors,
+	// fmt.Stringers and log.Object values. log.Lazy fields are expanded into
+	// the fields they emit first. Only the matching parts are redacted, unless
+	// the action is RedactionDrop.
+	ValuePattern string `yaml:"value_pattern"`
+
+	// Detector is a built-in detector, matched like ValuePattern.
+	Detector string `yaml:"detector"`
+
+	// Action defaults to RedactionMask.
+	Action RedactionAction `yaml:"action"`
+}
+
+var (
+	creditCardCandidate = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	bearerToken         = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`)
+	emailAddress        = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+)
+
+// compiledRedactionRule is a RedactionRule ready to match.
+type compiledRedactionRule struct {
+	key     string
+	pattern *regexp.Regexp
+	// validate, if set, filters the matches of pattern
+	validate func(string) bool
+	action   RedactionAction
+}
+
+// redactionProcessor is the SpanProcessor of Options.Redaction. It runs
+// right before the reporting stage, after any other processor.
+type redactionProcessor struct {
+	// Redactions made since the last status report, updated atomically.
+	// First to keep it 64-bit aligned on 32-bit platforms.
+	redactions int64
+
+	rules   []compiledRedactionRule
+	hashKey []byte
+	mask    string
+}
+
+func newRedactionProcessor(opts RedactionOptions) (*redactionProcessor, error) {
+	p := &redactionProcessor{
+		hashKey: []byte(opts.HashKey),
+		mask:    opts.Mask,
+	}
+	if p.mask == "" {
+		p.mask = DefaultRedactionMask
+	}
+	for i, rule := range opts.Rules {
+		compiled, err := compileRedactionRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %d: %v", i, err)
+		}
+		if compiled.action == RedactionHash && opts.HashKey == "" {
+			return nil, fmt.Errorf("redaction rule %d: the hash action requires a HashKey", i)
+		}
+		p.rules = append(p.rules, compiled)
+	}
+	return p, nil
+}
+
+func compileRedactionRule(rule RedactionRule) (compiledRedactionRule, error) {
+	compiled := compiledRedactionRule{action: rule.Action}
+	switch compiled.action {
+	case "":
+		compiled.action = RedactionMask
+	case RedactionMask, RedactionHash, RedactionDrop:
+	default:
+		return compiled, fmt.Errorf("unknown action %q", rule.Action)
+	}
+
+	matchers := 0
+	if rule.Key != "" {
+		matchers++
+		compiled.key = strings.ToLower(rule.Key)
+		if _, err := path.Match(compiled.key, ""); err != nil {
+			return compiled, fmt.Errorf("invalid key %q: %v", rule.Key, err)
+		}
+	}
+	if rule.ValuePattern != "" {
+		matchers++
+		pattern, err := regexp.Compile(rule.ValuePattern)
+		if err != nil {
+			return compiled, err
+		}
+		compiled.pattern = pattern
+	}
+	if rule.Detector != "" {
+		matchers++
+		switch rule.Detector {
+		case RedactionDetectorCreditCard:
+			compiled.pattern = creditCardCandidate
+			compiled.validate = luhnValid
+		case RedactionDetectorBearerToken:
+			compiled.pattern = bearerToken
+		case RedactionDetectorEmail:
+			compiled.pattern = emailAddress
+		default:
+			return compiled, fmt.Errorf("unknown detector %q", rule.Detector)
+		}
+	}
+	if matchers != 1 {
+		return compiled, fmt.Errorf("set exactly one of Key, ValuePattern and Detector")
+	}
+	return compiled, nil
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func (p *redactionProcessor) OnStart(opentracing.Span) {}
+
+// OnFinish redacts the operation name, tags, link attributes, log fields
+// and baggage of a span. Maps and slices are copied before they are changed,
+// since the span may share them with the application.
+func (p *redactionProcessor) OnFinish(raw RawSpan) (RawSpan, bool) {
+	raw.Operation = p.redactOperation(raw.Operation)
+
+	if tags, changed := p.redactTags(raw.Tags); changed {
+		raw.Tags = tags
+	}
+	linksCopied := false
+	for i, link := range raw.Links {
+		attributes, changed := p.redactTags(link.Attributes)
+		if !changed {
+			continue
+		}
+		if !linksCopied {
+			raw.Links = append([]SpanLink(nil), raw.Links...)
+			linksCopied = true
+		}
+		raw.Links[i].Attributes = attributes
+	}
+	if baggage, changed := p.redactBaggage(raw.Context.Baggage); changed {
+		raw.Context.Baggage = baggage
+	}
+	copied := false
+	for i, record := range raw.Logs {
+		fields, changed := p.redactFields(record.Fields)
+		if !changed {
+			continue
+		}
+		if !copied {
+			raw.Logs = append([]opentracing.LogRecord(nil), raw.Logs...)
+			copied = true
+		}
+		raw.Logs[i].Fields = fields
+	}
+	return raw, true
+}
+
+func (p *redactionProcessor) redactTags(tags opentracing.Tags) (opentracing.Tags, bool) {
+	var redacted opentracing.Tags
+	for key, value := range tags {
+		text, hasText := textOf(value)
+		newValue, drop, changed := p.redactKeyValue(key, value, text, hasText)
+		if !changed {
+			continue
+		}
+		if redacted == nil {
+			redacted = make(opentracing.Tags, len(tags))
+			for k, v := range tags {
+				redacted[k] = v
+			}
+		}
+		if drop {
+			delete(redacted, key)
+		} else {
+			redacted[key] = newValue
+		}
+	}
+	return redacted, redacted != nil
+}
+
+func (p *redactionProcessor) redactBaggage(baggage map[string]string) (map[string]string, bool) {
+	var redacted map[string]string
+	for key, value := range baggage {
+		newValue, drop, changed := p.redactKeyValue(key, value, value, true)
+		if !changed {
+			continue
+		}
+		if redacted == nil {
+			redacted = make(map[string]string, len(baggage))
+			for k, v := range baggage {
+				redacted[k] = v
+			}
+		}
+		if drop {
+			delete(redacted, key)
+		} else {
+			redacted[key] = newValue.(string)
+		}
+	}
+	return redacted, redacted != nil
+}
+
+func (p *redactionProcessor) redactFields(fields []log.Field) ([]log.Field, bool) {
+	fields, expanded := expandLazyFields(fields)
+	var redacted []log.Field
+	for i, field := range fields {
+		text, hasText := textOfField(field)
+		newValue, drop, changed := p.redactKeyValue(field.Key(), field.Value(), text, hasText)
+		if !changed {
+			if redacted != nil {
+				redacted = append(redacted, field)
+			}
+			continue
+		}
+		if redacted == nil {
+			redacted = append(make([]log.Field, 0, len(fields)), fields[:i]...)
+		}
+		if !drop {
+			redacted = append(redacted, log.String(field.Key(), newValue.(string)))
+		}
+	}
+	if redacted == nil && expanded {
+		return fields, true
+	}
+	return redacted, redacted != nil
+}
+
+// expandLazyFields replaces the log.Lazy fields among fields with the fields
+// they emit, so that the rules see them. It returns false if there are none.
+func expandLazyFields(fields []log.Field) ([]log.Field, bool) {
+	var expanded []log.Field
+	for i, field := range fields {
+		var recorder fieldRecorder
+		field.Marshal(&recorder)
+		if !recorder.lazy {
+			if expanded != nil {
+				expanded = append(expanded, field)
+			}
+			continue
+		}
+		if expanded == nil {
+			expanded = append(make([]log.Field, 0, len(fields)), fields[:i]...)
+		}
+		expanded = append(expanded, recorder.fields...)
+	}
+	if expanded == nil {
+		return fields, false
+	}
+	return expanded, true
+}
+
+// textOf returns the text that value rules match in a value: a string
+// itself, the decimal form of a number, or the text that the encoder reports
+// for an error or a fmt.Stringer.
+func textOf(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case int:
+		return strconv.FormatInt(int64(v), 10), true
+	case int8:
+		return strconv.FormatInt(int64(v), 10), true
+	case int16:
+		return strconv.FormatInt(int64(v), 10), true
+	case int32:
+		return strconv.FormatInt(int64(v), 10), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case error:
+		if !isNilPointer(v) {
+			return v.Error(), true
+		}
+	case fmt.Stringer:
+		if !isNilPointer(v) {
+			return v.String(), true
+		}
+	}
+	return "", false
+}
+
+// textOfField is textOf for log fields, where log.Object values that are not
+// text are matched in their JSON encoding, as the encoder reports them.
+func textOfField(field log.Field) (string, bool) {
+	if text, ok := textOf(field.Value()); ok {
+		return text, true
+	}
+	var recorder fieldRecorder
+	field.Marshal(&recorder)
+	if !recorder.object {
+		return "", false
+	}
+	jsonBytes, err := json.Marshal(field.Value())
+	if err != nil {
+		return "", false
+	}
+	return string(jsonBytes), true
+}
+
+// fieldRecorder is a log.Encoder that records the fields marshaled to it,
+// running log.Lazy fields to record the fields they emit. It tells which
+// kind of field it was given.
+type fieldRecorder struct {
+	fields []log.Field
+	lazy   bool
+	object bool
+}
+
+func (r *fieldRecorder) EmitString(key, value string) {
+	r.fields = append(r.fields, log.String(key, value))
+}
+
+func (r *fieldRecorder) EmitBool(key string, value bool) {
+	r.fields = append(r.fields, log.Bool(key, value))
+}
+
+func (r *fieldRecorder) EmitInt(key string, value int) {
+	r.fields = append(r.fields, log.Int(key, value))
+}
+
+func (r *fieldRecorder) EmitInt32(key string, value int32) {
+	r.fields = append(r.fields, log.Int32(key, value))
+}
+
+func (r *fieldRecorder) EmitInt64(key string, value int64) {
+	r.fields = append(r.fields, log.Int64(key, value))
+}
+
+func (r *fieldRecorder) EmitUint32(key string, value uint32) {
+	r.fields = append(r.fields, log.Uint32(key, value))
+}
+
+func (r *fieldRecorder) EmitUint64(key string, value uint64) {
+	r.fields = append(r.fields, log.Uint64(key, value))
+}
+
+func (r *fieldRecorder) EmitFloat32(key string, value float32) {
+	r.fields = append(r.fields, log.Float32(key, value))
+}
+
+func (r *fieldRecorder) EmitFloat64(key string, value float64) {
+	r.fields = append(r.fields, log.Float64(key, value))
+}
+
+func (r *fieldRecorder) EmitObject(key string, value interface{}) {
+	r.object = true
+	r.fields = append(r.fields, log.Object(key, value))
+}
+
+func (r *fieldRecorder) EmitLazyLogger(value log.LazyLogger) {
+	r.lazy = true
+	value(r)
+}
+
+// redactKeyValue applies the rules to a tag, log field or baggage item whose
+// text, if it has one, is str. Value rules only apply to values with text.
+// The new value is always a string.
+func (p *redactionProcessor) redactKeyValue(key string, value interface{}, str string, isString bool) (newValue interface{}, drop, changed bool) {
+	lowerKey := strings.ToLower(key)
+	for _, rule := range p.rules {
+		if rule.key != "" {
+			if matched, _ := path.Match(rule.key, lowerKey); !matched {
+				continue
+			}
+			p.count(1)
+			switch rule.action {
+			case RedactionDrop:
+				return nil, true, true
+			case RedactionHash:
+				str = p.hash(fmt.Sprint(value))
+			default:
+				str = p.mask
+			}
+			value, isString, changed = str, true, true
+			continue
+		}
+		if !isString {
+			continue
+		}
+		redacted, n := p.redactMatches(rule, str)
+		if n == 0 {
+			continue
+		}
+		if rule.action == RedactionDrop {
+			return nil, true, true
+		}
+		value, str, changed = redacted, redacted, true
+	}
+	return value, false, changed
+}
+
+// redactOperation applies the value rules to an operation name, which
+// cannot be dropped, so the drop action masks instead.
+func (p *redactionProcessor) redactOperation(operation string) string {
+	for _, rule := range p.rules {
+		if rule.pattern == nil {
+			continue
+		}
+		if rule.action == RedactionDrop {
+			rule.action = RedactionMask
+		}
+		operation, _ = p.redactMatches(rule, operation)
+	}
+	return operation
+}
+
+// redactMatches replaces the matches of a value rule in str, and returns the
+// number of matches, which it counts as redactions.
+func (p *redactionProcessor) redactMatches(rule compiledRedactionRule, str string) (string, int) {
+	n := 0
+	redacted := rule.pattern.ReplaceAllStringFunc(str, func(match string) string {
+		if rule.validate != nil && !rule.validate(match) {
+			return match
+		}
+		n++
+		if rule.action == RedactionHash {
+			return p.hash(match)
+		}
+		return p.mask
+	})
+	p.count(n)
+	return redacted, n
+}
+
+func (p *redactionProcessor) hash(value string) string {
+	mac := hmac.New(sha256.New, p.hashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *redactionProcessor) count(n int) {
+	if n > 0 {
+		atomic.AddInt64(&p.redactions, int64(n))
+	}
+}
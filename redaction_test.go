@@ -0,0 +1,180 @@
+package splunktracing
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+var _ = Describe("Redaction", func() {
+	newProcessor := func(opts RedactionOptions) *redactionProcessor {
+		p, err := newRedactionProcessor(opts)
+		Expect(err).NotTo(HaveOccurred())
+		return p
+	}
+
+	It("redacts tags by key, exactly or by glob, ignoring case", func() {
+		p := newProcessor(RedactionOptions{Rules: []RedactionRule{
+			{Key: "password"},
+			{Key: "http.request.header.*", Action: RedactionDrop},
+		}})
+		tags := opentracing.Tags{"Password": 1234, "http.request.header.cookie": "a=b", "user": "ann"}
+
+		raw, keep := p.OnFinish(RawSpan{Tags: tags})
+		Expect(keep).To(BeTrue())
+		Expect(raw.Tags).To(Equal(opentracing.Tags{"Password": DefaultRedactionMask, "user": "ann"}))
+		Expect(tags).To(HaveLen(3), "the span's own tags are not changed")
+		Expect(p.redactions).To(BeEquivalentTo(2))
+	})
+
+	It("redacts the matching parts of values with the built-in detectors", func() {
+		p := newProcessor(RedactionOptions{Mask: "***", Rules: []RedactionRule{
+			{Detector: RedactionDetectorCreditCard},
+			{Detector: RedactionDetectorBearerToken},
+			{Detector: RedactionDetectorEmail},
+		}})
+
+		raw, _ := p.OnFinish(RawSpan{Tags: opentracing.Tags{
+			"card":    "paid with 4111 1111 1111 1111",
+			"order":   "order 4111111111111112",
+			"auth":    "Bearer abc.def-ghi",
+			"contact": "mail ann@example.com or bob@example.org",
+			"count":   12,
+		}})
+		Expect(raw.Tags).To(Equal(opentracing.Tags{
+			"card":    "paid with ***",
+			"order":   "order 4111111111111112",
+			"auth":    "***",
+			"contact": "mail *** or ***",
+			"count":   12,
+		}))
+		Expect(p.redactions).To(BeEquivalentTo(4))
+	})
+
+	It("hashes values with a keyed SHA-256", func() {
+		p := newProcessor(RedactionOptions{HashKey: "secret", Rules: []RedactionRule{
+			{Key: "user.email", Action: RedactionHash},
+		}})
+		other := newProcessor(RedactionOptions{HashKey: "other", Rules: []RedactionRule{
+			{Key: "user.email", Action: RedactionHash},
+		}})
+
+		first, _ := p.OnFinish(RawSpan{Tags: opentracing.Tags{"user.email": "ann@example.com"}})
+		second, _ := p.OnFinish(RawSpan{Tags: opentracing.Tags{"user.email": "ann@example.com"}})
+		third, _ := other.OnFinish(RawSpan{Tags: opentracing.Tags{"user.email": "ann@example.com"}})
+		Expect(first.Tags["user.email"]).To(MatchRegexp("^[0-9a-f]{64}$"))
+		Expect(second.Tags["user.email"]).To(Equal(first.Tags["user.email"]))
+		Expect(third.Tags["user.email"]).NotTo(Equal(first.Tags["user.email"]))
+	})
+
+	It("redacts log fields, baggage and operation names", func() {
+		p := newProcessor(RedactionOptions{Rules: []RedactionRule{
+			{Key: "token", Action: RedactionDrop},
+			{ValuePattern: `\d{3}-\d{2}-\d{4}`, Action: RedactionDrop},
+			{Detector: RedactionDetectorEmail},
+		}})
+		logs := []opentracing.LogRecord{
+			{Fields: []log.Field{log.String("event", "login"), log.String("token", "t0k3n"), log.Int("attempt", 2)}},
+			{Fields: []log.Field{log.String("event", "ok")}},
+		}
+
+		raw, _ := p.OnFinish(RawSpan{
+			Operation: "lookup ann@example.com",
+			Context:   SpanContext{Baggage: map[string]string{"ssn": "123-45-6789", "tenant": "acme"}},
+			Logs:      logs,
+		})
+		Expect(raw.Operation).To(Equal("lookup " + DefaultRedactionMask))
+		Expect(raw.Context.Baggage).To(Equal(map[string]string{"tenant": "acme"}))
+		Expect(raw.Logs[0].Fields).To(Equal([]log.Field{log.String("event", "login"), log.Int("attempt", 2)}))
+		Expect(raw.Logs[1]).To(Equal(logs[1]))
+		Expect(logs[0].Fields).To(HaveLen(3), "the span's own logs are not changed")
+	})
+
+	It("redacts the text of errors, Stringers and objects, and link attributes", func() {
+		p := newProcessor(RedactionOptions{Rules: []RedactionRule{{Detector: RedactionDetectorEmail}}})
+		links := []SpanLink{{TraceID: 1, SpanID: 2, Attributes: opentracing.Tags{"owner": "ann@example.com", "n": 1}}}
+
+		raw, _ := p.OnFinish(RawSpan{
+			Tags: opentracing.Tags{
+				"err":   errors.New("user bob@example.com not found"),
+				"other": errors.New("not found"),
+			},
+			Logs: []opentracing.LogRecord{{Fields: []log.Field{
+				log.Error(errors.New("bob@example.com")),
+				log.Object("user", map[string]string{"email": "bob@example.com"}),
+				log.Object("count", 3),
+			}}},
+			Links: links,
+		})
+		Expect(raw.Tags["err"]).To(Equal("user " + DefaultRedactionMask + " not found"))
+		Expect(raw.Tags["other"]).To(Equal(errors.New("not found")))
+		Expect(raw.Logs[0].Fields).To(Equal([]log.Field{
+			log.String("error", DefaultRedactionMask),
+			log.String("user", `{"email":"`+DefaultRedactionMask+`"}`),
+			log.Object("count", 3),
+		}))
+		Expect(raw.Links[0].Attributes).To(Equal(opentracing.Tags{"owner": DefaultRedactionMask, "n": 1}))
+		Expect(links[0].Attributes["owner"]).To(Equal("ann@example.com"), "the span's own links are not changed")
+	})
+
+	It("redacts the fields emitted by lazy log fields, and numbers", func() {
+		p := newProcessor(RedactionOptions{Rules: []RedactionRule{
+			{Key: "password"},
+			{Detector: RedactionDetectorEmail},
+			{Detector: RedactionDetectorCreditCard},
+		}})
+
+		raw, _ := p.OnFinish(RawSpan{
+			Tags: opentracing.Tags{"card": int64(4111111111111111), "count": 12},
+			Logs: []opentracing.LogRecord{{Fields: []log.Field{
+				log.String("event", "login"),
+				log.Lazy(func(e log.Encoder) {
+					e.EmitString("email", "bob@example.com")
+					e.EmitString("password", "hunter2")
+					e.EmitInt("attempt", 2)
+				}),
+			}}},
+		})
+		Expect(raw.Tags).To(Equal(opentracing.Tags{"card": DefaultRedactionMask, "count": 12}))
+		Expect(raw.Logs[0].Fields).To(Equal([]log.Field{
+			log.String("event", "login"),
+			log.String("email", DefaultRedactionMask),
+			log.String("password", DefaultRedactionMask),
+			log.Int("attempt", 2),
+		}))
+	})
+
+	It("rejects invalid rules", func() {
+		for _, opts := range []RedactionOptions{
+			{Rules: []RedactionRule{{ValuePattern: "("}}},
+			{Rules: []RedactionRule{{Detector: "phone"}}},
+			{Rules: []RedactionRule{{Key: "a", Action: "shred"}}},
+			{Rules: []RedactionRule{{Key: "a", Action: RedactionHash}}},
+			{Rules: []RedactionRule{{Key: "a", Detector: RedactionDetectorEmail}}},
+			{Rules: []RedactionRule{{}}},
+		} {
+			_, err := newRedactionProcessor(opts)
+			Expect(err).To(HaveOccurred())
+		}
+	})
+
+	It("runs in the tracer before reporting, and counts redactions in status reports", func() {
+		recorder := &countingRecorder{}
+		tracer := newTestTracer(Options{
+			Recorder:           recorder,
+			MinReportingPeriod: time.Hour,
+			Redaction:          &RedactionOptions{Rules: []RedactionRule{{Key: "password"}}},
+		})
+		defer closeTestTracer(tracer)
+
+		tracer.StartSpan("op", opentracing.Tag{Key: "password", Value: "hunter2"}).Finish()
+		Expect(recorder.Spans()[0].Tags["password"]).To(Equal(DefaultRedactionMask))
+		Expect(tracer.buffer.rawSpans[0].Tags["password"]).To(Equal(DefaultRedactionMask))
+
+		Expect(tracer.postFlush(nil).Redactions()).To(Equal(1))
+	})
+})
@@ -8,6 +8,7 @@ type reportBuffer struct {
 	rawSpans             []RawSpan
 	droppedSpanCount     int64
 	logEncoderErrorCount int64
+	reportedBytes        int64 // size of the encoded report, set by toRequest
 	reportStart          time.Time
 	reportEnd            time.Time
 }
@@ -38,6 +39,7 @@ func (b *reportBuffer) clear() {
 	b.reportEnd = time.Time{}
 	b.droppedSpanCount = 0
 	b.logEncoderErrorCount = 0
+	b.reportedBytes = 0
 }
 
 func (b *reportBuffer) addSpan(span RawSpan) {
@@ -0,0 +1,139 @@
+package splunktracing
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+)
+
+// Resource attribute keys, reported in the "resource" object of span events.
+const (
+	ResourceServiceNameKey           = "service.name"
+	ResourceServiceVersionKey        = "service.version"
+	ResourceDeploymentEnvironmentKey = "deployment.environment"
+	ResourceHostNameKey              = "host.name"
+	ResourceProcessPIDKey            = "process.pid"
+	ResourceProcessRuntimeNameKey    = "process.runtime.name"
+	ResourceProcessRuntimeVersionKey = "process.runtime.version"
+)
+
+var resourceStandardKeys = map[string]bool{
+	ResourceServiceNameKey:           true,
+	ResourceServiceVersionKey:        true,
+	ResourceDeploymentEnvironmentKey: true,
+	ResourceHostNameKey:              true,
+	ResourceProcessPIDKey:            true,
+	ResourceProcessRuntimeNameKey:    true,
+	ResourceProcessRuntimeVersionKey: true,
+}
+
+// Resource identifies the service and process that produce spans. It is
+// reported as the "resource" object of every span event, apart from the
+// span's tags.
+//
+// ServiceName and HostName take precedence over the ComponentNameKey and
+// HostnameKey tags, which are kept in sync with them: a tag that is set
+// fills the Resource field left empty, and a field that is set fills the
+// tag left unset. Setting both to different values is an error. When
+// neither is set, they default to the program name and the host name.
+type Resource struct {
+	ServiceName           string `yaml:"service_name" json:"service_name"`
+	ServiceVersion        string `yaml:"service_version" json:"service_version"`
+	DeploymentEnvironment string `yaml:"deployment_environment" json:"deployment_environment"`
+	HostName              string `yaml:"host_name" json:"host_name"`
+
+	// ProcessPID defaults to the PID of this process.
+	ProcessPID int `yaml:"process_pid" json:"process_pid"`
+
+	// Attributes are additional resource attributes. They may not redefine
+	// the attributes above.
+	Attributes map[string]string `yaml:"attributes" json:"attributes"`
+}
+
+// validate checks the resource against itself and the legacy tags.
+func (r *Resource) validate(tags map[string]interface{}) error {
+	if err := checkResourceTag(ResourceServiceNameKey, r.ServiceName, tags, ComponentNameKey); err != nil {
+		return err
+	}
+	if err := checkResourceTag(ResourceHostNameKey, r.HostName, tags, HostnameKey); err != nil {
+		return err
+	}
+	if r.ProcessPID < 0 {
+		return fmt.Errorf("Options invalid: Resource.ProcessPID is negative: %d", r.ProcessPID)
+	}
+	for key := range r.Attributes {
+		if key == "" {
+			return fmt.Errorf("Options invalid: Resource.Attributes has an empty key")
+		}
+		if resourceStandardKeys[key] {
+			return fmt.Errorf("Options invalid: Resource.Attributes redefines %q", key)
+		}
+	}
+	return nil
+}
+
+func checkResourceTag(key, value string, tags map[string]interface{}, tagKey string) error {
+	if value == "" {
+		return nil
+	}
+	if tagValue, found := tags[tagKey]; found && fmt.Sprint(tagValue) != value {
+		return fmt.Errorf("Options invalid: resource %v %q conflicts with the %v tag %q", key, value, tagKey, tagValue)
+	}
+	return nil
+}
+
+// setDefaults applies the precedence rules between the resource, the legacy
+// tags and the defaults, and syncs the legacy tags with the result.
+func (r *Resource) setDefaults(tags map[string]interface{}) {
+	r.ServiceName = resolveResourceTag(r.ServiceName, tags, ComponentNameKey, func() string {
+		return path.Base(os.Args[0])
+	})
+	r.HostName = resolveResourceTag(r.HostName, tags, HostnameKey, func() string {
+		hostname, _ := os.Hostname()
+		return hostname
+	})
+	if r.ProcessPID == 0 {
+		r.ProcessPID = os.Getpid()
+	}
+}
+
+func resolveResourceTag(value string, tags map[string]interface{}, tagKey string, defaultValue func() string) string {
+	if value == "" {
+		if tagValue, found := tags[tagKey]; found {
+			value = fmt.Sprint(tagValue)
+		} else {
+			value = defaultValue()
+		}
+	}
+	if _, found := tags[tagKey]; !found {
+		tags[tagKey] = value
+	}
+	return value
+}
+
+// toMap returns the "resource" object of span events, omitting empty
+// attributes.
+func (r *Resource) toMap() map[string]interface{} {
+	attributes := map[string]interface{}{
+		ResourceProcessRuntimeNameKey:    TracerPlatformValue,
+		ResourceProcessRuntimeVersionKey: runtime.Version(),
+	}
+	for key, value := range map[string]string{
+		ResourceServiceNameKey:           r.ServiceName,
+		ResourceServiceVersionKey:        r.ServiceVersion,
+		ResourceDeploymentEnvironmentKey: r.DeploymentEnvironment,
+		ResourceHostNameKey:              r.HostName,
+	} {
+		if value != "" {
+			attributes[key] = value
+		}
+	}
+	if r.ProcessPID != 0 {
+		attributes[ResourceProcessPIDKey] = r.ProcessPID
+	}
+	for key, value := range r.Attributes {
+		attributes[key] = value
+	}
+	return attributes
+}
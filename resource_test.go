@@ -0,0 +1,146 @@
+package splunktracing
+
+import (
+	"os"
+	"runtime"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+)
+
+var _ = Describe("Resource", func() {
+	var opts Options
+
+	BeforeEach(func() {
+		opts = Options{AccessToken: "token"}
+	})
+
+	It("defaults to the legacy tags, and else to the program and host", func() {
+		opts.Tags = opentracing.Tags{ComponentNameKey: "checkout"}
+		Expect(opts.Initialize()).To(Succeed())
+
+		hostname, _ := os.Hostname()
+		Expect(opts.Resource.ServiceName).To(Equal("checkout"))
+		Expect(opts.Resource.HostName).To(Equal(hostname))
+		Expect(opts.Resource.ProcessPID).To(Equal(os.Getpid()))
+		Expect(opts.Tags).To(HaveKeyWithValue(HostnameKey, hostname))
+	})
+
+	It("maps service.name and host.name onto the legacy tags", func() {
+		opts.Resource = Resource{ServiceName: "checkout", HostName: "web-1"}
+		Expect(opts.Initialize()).To(Succeed())
+		Expect(opts.Tags).To(HaveKeyWithValue(ComponentNameKey, "checkout"))
+		Expect(opts.Tags).To(HaveKeyWithValue(HostnameKey, "web-1"))
+	})
+
+	It("rejects invalid resources", func() {
+		for _, invalid := range []Options{
+			{Resource: Resource{ServiceName: "checkout"}, Tags: opentracing.Tags{ComponentNameKey: "cart"}},
+			{Resource: Resource{HostName: "web-1"}, Tags: opentracing.Tags{HostnameKey: "web-2"}},
+			{Resource: Resource{ProcessPID: -1}},
+			{Resource: Resource{Attributes: map[string]string{"": "x"}}},
+			{Resource: Resource{Attributes: map[string]string{ResourceServiceVersionKey: "1.0"}}},
+		} {
+			Expect(invalid.Initialize()).NotTo(Succeed())
+		}
+	})
+
+	It("is reported as the resource object of span events", func() {
+		opts.Resource = Resource{
+			ServiceName:           "checkout",
+			ServiceVersion:        "1.2.3",
+			DeploymentEnvironment: "prod",
+			HostName:              "web-1",
+			ProcessPID:            42,
+			Attributes:            map[string]string{"cloud.region": "us-east-1"},
+		}
+		Expect(opts.Initialize()).To(Succeed())
+		converter := newHECConverter(opts)
+		span := RawSpan{Context: SpanContext{TraceID: 1, SpanID: 2}, Operation: "op", Start: time.Now()}
+
+		event := hecEvents(converter.toSpan(span, &reportBuffer{}, nil))[0]
+		Expect(event["resource"]).To(Equal(map[string]interface{}{
+			ResourceServiceNameKey:           "checkout",
+			ResourceServiceVersionKey:        "1.2.3",
+			ResourceDeploymentEnvironmentKey: "prod",
+			ResourceHostNameKey:              "web-1",
+			ResourceProcessPIDKey:            42.0,
+			ResourceProcessRuntimeNameKey:    "go",
+			ResourceProcessRuntimeVersionKey: runtime.Version(),
+			"cloud.region":                   "us-east-1",
+		}))
+	})
+
+	It("reports the tracer attributes in the resource only", func() {
+		opts.Resource = Resource{ServiceName: "checkout", HostName: "web-1", Attributes: map[string]string{"region": "us-east-1"}}
+		opts.Tags = opentracing.Tags{"team": "payments", "region": "eu"}
+		Expect(opts.Initialize()).To(Succeed())
+		converter := newHECConverter(opts)
+		span := RawSpan{
+			Context:   SpanContext{TraceID: 1, SpanID: 2},
+			Operation: "op",
+			Start:     time.Now(),
+			Tags:      opentracing.Tags{"http.method": "GET"},
+		}
+		attributes := map[string]string{
+			ComponentNameKey:  "checkout",
+			HostnameKey:       "web-1",
+			TracerPlatformKey: TracerPlatformValue,
+			TracerVersionKey:  TracerVersionValue,
+			"team":            "payments",
+			"region":          "eu",
+		}
+
+		event := hecEvents(converter.toSpan(span, &reportBuffer{}, attributes))[0]
+		Expect(event).NotTo(HaveKey(ComponentNameKey))
+		Expect(event).NotTo(HaveKey(HostnameKey))
+		Expect(event).NotTo(HaveKey(TracerPlatformKey))
+		Expect(event).NotTo(HaveKey(TracerVersionKey))
+		Expect(event["tags"]).To(Equal(map[string]interface{}{"http.method": "GET"}))
+
+		resource := event["resource"].(map[string]interface{})
+		Expect(resource).To(HaveKeyWithValue(ResourceServiceNameKey, "checkout"))
+		Expect(resource).To(HaveKeyWithValue(ResourceHostNameKey, "web-1"))
+		Expect(resource).To(HaveKeyWithValue(TracerPlatformKey, TracerPlatformValue))
+		Expect(resource).To(HaveKeyWithValue(TracerVersionKey, TracerVersionValue))
+		Expect(resource).To(HaveKeyWithValue("team", "payments"))
+		Expect(resource).To(HaveKeyWithValue("region", "us-east-1"))
+		Expect(resource).NotTo(HaveKey(ComponentNameKey))
+		Expect(resource).NotTo(HaveKey(HostnameKey))
+	})
+
+	It("keeps the legacy layout of the tracer attributes when asked to", func() {
+		opts.Resource = Resource{ServiceName: "checkout", HostName: "web-1"}
+		opts.LegacyTracerAttributes = true
+		opts.Tags = opentracing.Tags{"team": "payments", "region": "eu"}
+		Expect(opts.Initialize()).To(Succeed())
+		converter := newHECConverter(opts)
+		span := RawSpan{
+			Context:   SpanContext{TraceID: 1, SpanID: 2},
+			Operation: "op",
+			Start:     time.Now(),
+			Tags:      opentracing.Tags{"region": "us"},
+		}
+		attributes := map[string]string{
+			ComponentNameKey:  "checkout",
+			HostnameKey:       "web-1",
+			TracerPlatformKey: TracerPlatformValue,
+			TracerVersionKey:  TracerVersionValue,
+			"team":            "payments",
+			"region":          "eu",
+		}
+
+		event := hecEvents(converter.toSpan(span, &reportBuffer{}, attributes))[0]
+		Expect(event).To(HaveKeyWithValue(ComponentNameKey, "checkout"))
+		Expect(event).To(HaveKeyWithValue(HostnameKey, "web-1"))
+		Expect(event).To(HaveKeyWithValue(TracerPlatformKey, TracerPlatformValue))
+		Expect(event).To(HaveKeyWithValue(TracerVersionKey, TracerVersionValue))
+		Expect(event["tags"]).To(Equal(map[string]interface{}{"team": "payments", "region": "us"}))
+		Expect(event["resource"]).To(HaveKeyWithValue(ResourceServiceNameKey, "checkout"))
+		Expect(event["resource"]).To(HaveKeyWithValue(ResourceHostNameKey, "web-1"))
+		Expect(event["resource"]).NotTo(HaveKey(TracerVersionKey))
+		Expect(event["resource"]).NotTo(HaveKey("team"))
+	})
+})
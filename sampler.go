@@ -0,0 +1,120 @@
+package splunktracing
+
+import (
+	"math"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// Tag keys describing the sampling decision, added to the root span of each
+// sampled trace.
+const (
+	SamplerTypeTagKey  = "sampler.type"
+	SamplerParamTagKey = "sampler.param"
+)
+
+// Sampler types reported in the SamplerTypeTagKey tag.
+const (
+	SamplerTypeConst         = "const"
+	SamplerTypeProbabilistic = "probabilistic"
+	SamplerTypePerOperation  = "peroperation"
+)
+
+// A Sampler decides whether a trace is recorded. The decision is made once,
+// when the root span of the trace starts, and is inherited by its children
+// and propagated to downstream services.
+type Sampler interface {
+	Sample(SamplingParameters) SamplingDecision
+}
+
+// SamplingParameters describes the root span of the trace being sampled.
+type SamplingParameters struct {
+	TraceID     uint64
+	TraceIDHigh uint64
+	Operation   string
+}
+
+// SamplingDecision is a Sampler's verdict on a trace.
+type SamplingDecision struct {
+	Sampled bool
+
+	// Retryable marks a decision that depends on the operation name. If the
+	// root span is renamed with SetOperationName before its context is used
+	// to start a child or to Inject, the Sampler is consulted again.
+	Retryable bool
+
+	// Tags describe how the decision was made, e.g. the sampler type and
+	// rate. They are added to the root span.
+	Tags opentracing.Tags
+
+	// Weight is the number of traces a sampled trace stands for: the inverse
+	// of the probability that it was sampled. Zero is reported as 1.
+	Weight float64
+}
+
+// maxRandomID bounds the IDs produced by genSeededGUID. Masking trace IDs
+// from other tracers with it keeps sampling uniform over the same range.
+const maxRandomID = math.MaxInt64
+
+type constSampler struct {
+	decision SamplingDecision
+}
+
+// NewConstSampler returns a Sampler that makes the same decision for every
+// trace.
+func NewConstSampler(sample bool) Sampler {
+	return &constSampler{
+		decision: SamplingDecision{
+			Sampled: sample,
+			Tags: opentracing.Tags{
+				SamplerTypeTagKey:  SamplerTypeConst,
+				SamplerParamTagKey: sample,
+			},
+			Weight: 1,
+		},
+	}
+}
+
+func (s *constSampler) Sample(SamplingParameters) SamplingDecision {
+	return s.decision
+}
+
+type probabilisticSampler struct {
+	rate     float64
+	boundary uint64
+	weight   float64
+	tags     opentracing.Tags
+}
+
+// NewProbabilisticSampler returns a Sampler that records the given fraction
+// of traces. The rate is clamped to [0, 1]. The decision depends only on the
+// low 63 bits of the trace ID, so every process in a trace configured with
+// the same rate makes the same decision.
+func NewProbabilisticSampler(rate float64) Sampler {
+	return newProbabilisticSampler(rate)
+}
+
+func newProbabilisticSampler(rate float64) *probabilisticSampler {
+	rate = math.Max(0, math.Min(1, rate))
+	var weight float64
+	if rate > 0 {
+		weight = 1 / rate
+	}
+	return &probabilisticSampler{
+		rate:     rate,
+		boundary: uint64(rate * (maxRandomID + 1)),
+		weight:   weight,
+		tags: opentracing.Tags{
+			SamplerTypeTagKey:  SamplerTypeProbabilistic,
+			SamplerParamTagKey: rate,
+		},
+	}
+}
+
+func (s *probabilisticSampler) Sample(params SamplingParameters) SamplingDecision {
+	return SamplingDecision{
+		Sampled: params.TraceID&maxRandomID < s.boundary,
+		Tags:    s.tags,
+		Weight:  s.weight,
+	}
+}
@@ -0,0 +1,167 @@
+package splunktracing
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// SamplerTypeAdaptive is reported in the SamplerTypeTagKey tag of traces
+// sampled by an adaptive sampler.
+const SamplerTypeAdaptive = "adaptive"
+
+// Defaults for AdaptiveSamplerOptions.
+const (
+	DefaultAdaptiveMinRate   = 0.001
+	DefaultAdaptiveMaxRate   = 1.0
+	DefaultAdaptiveSmoothing = 0.5
+)
+
+// adaptiveFillHighWater is the report buffer fill level above which the
+// adaptive sampler lowers its rate whatever the throughput targets.
+const adaptiveFillHighWater = 0.8
+
+// AdaptiveSamplerOptions configure NewAdaptiveSampler.
+type AdaptiveSamplerOptions struct {
+	// TargetSpansPerSecond and TargetBytesPerSecond are the throughput the
+	// sampler aims to report. Either or both may be set; the tighter one
+	// wins. With neither, the rate only backs off when the report buffer
+	// overflows or fills up.
+	TargetSpansPerSecond float64 `yaml:"target_spans_per_second"`
+	TargetBytesPerSecond float64 `yaml:"target_bytes_per_second"`
+
+	// InitialRate is the probability used until the first report. Defaults
+	// to MaxRate.
+	InitialRate float64 `yaml:"initial_rate"`
+
+	// MinRate and MaxRate bound the probability. Default to
+	// DefaultAdaptiveMinRate and DefaultAdaptiveMaxRate.
+	MinRate float64 `yaml:"min_rate"`
+	MaxRate float64 `yaml:"max_rate"`
+
+	// Smoothing, in (0, 1], is how far each report moves the rate towards
+	// the rate it calls for. Defaults to DefaultAdaptiveSmoothing.
+	Smoothing float64 `yaml:"smoothing"`
+}
+
+// flushStats describes one report interval, as seen by the tracer after a
+// flush.
+type flushStats struct {
+	interval time.Duration
+	// spans reported, or that would have been had the report succeeded
+	reportedSpans int
+	// spans dropped because the report buffer was full
+	droppedSpans int
+	// size of the encoded report, or zero if unknown
+	reportedBytes int64
+	// fraction of the report buffer in use when the flush started
+	bufferFill float64
+}
+
+// flushObserver is implemented by samplers that adapt to how well reporting
+// keeps up. The tracer calls observeFlush after every flush; it returns the
+// sampler's new rate, which goes into the status report.
+type flushObserver interface {
+	observeFlush(flushStats) float64
+}
+
+type adaptiveSampler struct {
+	opts AdaptiveSamplerOptions
+
+	// current holds the *probabilisticSampler for the current rate.
+	current atomic.Value
+
+	// the following fields are modified under the lock by observeFlush.
+	lock         sync.Mutex
+	bytesPerSpan float64
+}
+
+// NewAdaptiveSampler returns a Sampler that samples traces by probability,
+// like NewProbabilisticSampler, and adjusts that probability after every
+// report to hit the throughput targets in opts. It is safe for concurrent
+// use. Configure it as Options.Sampler; its current rate is reported by
+// EventStatusReport.SamplingRate.
+func NewAdaptiveSampler(opts AdaptiveSamplerOptions) Sampler {
+	return newAdaptiveSampler(opts)
+}
+
+func newAdaptiveSampler(opts AdaptiveSamplerOptions) *adaptiveSampler {
+	if opts.MaxRate <= 0 || opts.MaxRate > 1 {
+		opts.MaxRate = DefaultAdaptiveMaxRate
+	}
+	if opts.MinRate <= 0 {
+		opts.MinRate = DefaultAdaptiveMinRate
+	}
+	if opts.MinRate > opts.MaxRate {
+		opts.MinRate = opts.MaxRate
+	}
+	if opts.InitialRate <= 0 {
+		opts.InitialRate = opts.MaxRate
+	}
+	if opts.Smoothing <= 0 || opts.Smoothing > 1 {
+		opts.Smoothing = DefaultAdaptiveSmoothing
+	}
+	s := &adaptiveSampler{opts: opts}
+	s.setRate(opts.InitialRate)
+	return s
+}
+
+func (s *adaptiveSampler) Sample(params SamplingParameters) SamplingDecision {
+	return s.current.Load().(*probabilisticSampler).Sample(params)
+}
+
+func (s *adaptiveSampler) rate() float64 {
+	return s.current.Load().(*probabilisticSampler).rate
+}
+
+func (s *adaptiveSampler) setRate(rate float64) {
+	rate = math.Max(s.opts.MinRate, math.Min(s.opts.MaxRate, rate))
+	sampler := newProbabilisticSampler(rate)
+	sampler.tags = opentracing.Tags{
+		SamplerTypeTagKey:  SamplerTypeAdaptive,
+		SamplerParamTagKey: sampler.rate,
+	}
+	s.current.Store(sampler)
+}
+
+func (s *adaptiveSampler) observeFlush(stats flushStats) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	rate := s.rate()
+	if stats.interval <= 0 {
+		return rate
+	}
+
+	// Spans recorded in the interval at the current rate, whether or not
+	// they fit in the buffer.
+	recorded := float64(stats.reportedSpans + stats.droppedSpans)
+	if stats.reportedSpans > 0 && stats.reportedBytes > 0 {
+		s.bytesPerSpan = float64(stats.reportedBytes) / float64(stats.reportedSpans)
+	}
+
+	target := s.opts.MaxRate
+	if recorded > 0 {
+		spansPerSecond := recorded / stats.interval.Seconds()
+		if s.opts.TargetSpansPerSecond > 0 {
+			target = math.Min(target, rate*s.opts.TargetSpansPerSecond/spansPerSecond)
+		}
+		if s.opts.TargetBytesPerSecond > 0 && s.bytesPerSpan > 0 {
+			target = math.Min(target, rate*s.opts.TargetBytesPerSecond/(spansPerSecond*s.bytesPerSpan))
+		}
+	}
+	// Whatever the targets, back off when spans did not fit in the buffer
+	// or it is close to overflowing.
+	if stats.droppedSpans > 0 {
+		target = math.Min(target, rate*float64(stats.reportedSpans)/recorded)
+	}
+	if stats.bufferFill > adaptiveFillHighWater {
+		target = math.Min(target, rate*adaptiveFillHighWater/stats.bufferFill)
+	}
+
+	s.setRate(rate + s.opts.Smoothing*(target-rate))
+	return s.rate()
+}
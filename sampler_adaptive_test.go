@@ -0,0 +1,96 @@
+package splunktracing
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+)
+
+var _ = Describe("Adaptive sampler", func() {
+	var opts AdaptiveSamplerOptions
+
+	BeforeEach(func() {
+		opts = AdaptiveSamplerOptions{TargetSpansPerSecond: 100, Smoothing: 1}
+	})
+
+	It("starts at the maximum rate and tags its decisions", func() {
+		sampler := newAdaptiveSampler(opts)
+		decision := sampler.Sample(SamplingParameters{TraceID: 1})
+		Expect(decision.Sampled).To(BeTrue())
+		Expect(decision.Tags).To(Equal(opentracing.Tags{
+			SamplerTypeTagKey:  SamplerTypeAdaptive,
+			SamplerParamTagKey: 1.0,
+		}))
+	})
+
+	It("moves towards the rate that meets the spans per second target", func() {
+		sampler := newAdaptiveSampler(opts)
+		Expect(sampler.observeFlush(flushStats{interval: time.Second, reportedSpans: 400})).To(Equal(0.25))
+		Expect(sampler.Sample(SamplingParameters{}).Tags[SamplerParamTagKey]).To(Equal(0.25))
+
+		// At a quarter of the traffic, the target is met and the rate holds.
+		Expect(sampler.observeFlush(flushStats{interval: time.Second, reportedSpans: 100})).To(Equal(0.25))
+	})
+
+	It("smooths the adjustment", func() {
+		opts.Smoothing = 0.5
+		sampler := newAdaptiveSampler(opts)
+		Expect(sampler.observeFlush(flushStats{interval: time.Second, reportedSpans: 400})).To(Equal(0.625))
+	})
+
+	It("meets a bytes per second target using the measured span size", func() {
+		opts = AdaptiveSamplerOptions{TargetBytesPerSecond: 1000, Smoothing: 1}
+		sampler := newAdaptiveSampler(opts)
+		rate := sampler.observeFlush(flushStats{interval: 2 * time.Second, reportedSpans: 40, reportedBytes: 4000})
+		Expect(rate).To(Equal(0.5))
+	})
+
+	It("backs off when spans are dropped or the buffer fills up", func() {
+		opts.TargetSpansPerSecond = 0
+		sampler := newAdaptiveSampler(opts)
+		Expect(sampler.observeFlush(flushStats{interval: time.Second, reportedSpans: 75, droppedSpans: 25})).To(Equal(0.75))
+		Expect(sampler.observeFlush(flushStats{interval: time.Second, reportedSpans: 90, bufferFill: 0.9})).To(BeNumerically("~", 0.75*0.8/0.9))
+	})
+
+	It("recovers when traffic falls", func() {
+		sampler := newAdaptiveSampler(opts)
+		sampler.observeFlush(flushStats{interval: time.Second, reportedSpans: 1000})
+		Expect(sampler.observeFlush(flushStats{interval: time.Second})).To(Equal(1.0))
+	})
+
+	It("stays within its bounds", func() {
+		opts.MinRate = 0.2
+		opts.MaxRate = 0.5
+		sampler := newAdaptiveSampler(opts)
+		Expect(sampler.rate()).To(Equal(0.5))
+		Expect(sampler.observeFlush(flushStats{interval: time.Second, reportedSpans: 100000})).To(Equal(0.2))
+	})
+
+	Context("configured on a tracer", func() {
+		var tracer *tracerImpl
+
+		BeforeEach(func() {
+			tracer = newTestTracer(Options{
+				MaxBufferedSpans:   10,
+				MinReportingPeriod: time.Hour,
+				Sampler:            NewAdaptiveSampler(AdaptiveSamplerOptions{Smoothing: 1}),
+			})
+		})
+
+		AfterEach(func() {
+			closeTestTracer(tracer)
+		})
+
+		It("feeds dropped spans back and reports the rate", func() {
+			for i := 0; i < 20; i++ {
+				tracer.StartSpan("op", opentracing.ChildOf(SpanContext{TraceID: 1, SpanID: 2, Sampled: true})).Finish()
+			}
+			Expect(tracer.preFlush()).To(BeNil())
+			report := tracer.postFlush(nil)
+			Expect(report.DroppedSpans()).To(Equal(10))
+			Expect(report.SamplingRate()).To(Equal(0.5))
+		})
+	})
+})
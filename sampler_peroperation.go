@@ -0,0 +1,147 @@
+package splunktracing
+
+import (
+	"path"
+	"sort"
+	"sync"
+)
+
+// DefaultMaxSampledOperations is the default for
+// PerOperationSamplerOptions.MaxOperations.
+const DefaultMaxSampledOperations = 2000
+
+// PerOperationSamplerOptions configures NewPerOperationSampler.
+type PerOperationSamplerOptions struct {
+	// DefaultRate is the sampling probability of operations that match no
+	// entry in Rates.
+	DefaultRate float64 `yaml:"default_rate" json:"default_rate"`
+
+	// Rates maps operation names, or path.Match globs such as "GET /health*",
+	// to sampling probabilities. An exact name wins over globs; among globs,
+	// the longest matching pattern wins.
+	Rates map[string]float64 `yaml:"rates" json:"rates"`
+
+	// MaxOperations caps the number of distinct operation names tracked.
+	// Operations first seen beyond the cap are still sampled at their rate,
+	// but without the MinTracesPerSecond guarantee. If zero,
+	// DefaultMaxSampledOperations is used.
+	MaxOperations int `yaml:"max_operations" json:"max_operations"`
+
+	// MinTracesPerSecond, if positive, guarantees each tracked operation
+	// this many traces per second on top of its rate, as with
+	// NewGuaranteedThroughputSampler.
+	MinTracesPerSecond float64 `yaml:"min_traces_per_second" json:"min_traces_per_second"`
+}
+
+type globRate struct {
+	pattern string
+	sampler *probabilisticSampler
+}
+
+type perOperationSampler struct {
+	// the probabilistic samplers of the entries of Rates and of DefaultRate,
+	// which also sample the operations that are not tracked
+	exact          map[string]*probabilisticSampler
+	globs          []globRate
+	defaultSampler *probabilisticSampler
+
+	maxOperations      int
+	minTracesPerSecond float64
+
+	lock       sync.RWMutex
+	operations map[string]Sampler // samplers of tracked operations
+}
+
+// NewPerOperationSampler returns a Sampler that samples each operation with
+// its own probability. Its decisions are retryable: renaming a root span
+// with SetOperationName samples it again under the new name, as long as the
+// span's context has not been shared yet.
+func NewPerOperationSampler(opts PerOperationSamplerOptions) Sampler {
+	return newPerOperationSampler(opts)
+}
+
+func newPerOperationSampler(opts PerOperationSamplerOptions) *perOperationSampler {
+	s := &perOperationSampler{
+		exact:              map[string]*probabilisticSampler{},
+		defaultSampler:     newProbabilisticSampler(opts.DefaultRate),
+		maxOperations:      opts.MaxOperations,
+		minTracesPerSecond: opts.MinTracesPerSecond,
+		operations:         map[string]Sampler{},
+	}
+	if s.maxOperations <= 0 {
+		s.maxOperations = DefaultMaxSampledOperations
+	}
+	for pattern, rate := range opts.Rates {
+		if isGlob(pattern) {
+			s.globs = append(s.globs, globRate{pattern: pattern, sampler: newProbabilisticSampler(rate)})
+		} else {
+			s.exact[pattern] = newProbabilisticSampler(rate)
+		}
+	}
+	sort.Slice(s.globs, func(i, j int) bool {
+		if len(s.globs[i].pattern) != len(s.globs[j].pattern) {
+			return len(s.globs[i].pattern) > len(s.globs[j].pattern)
+		}
+		return s.globs[i].pattern < s.globs[j].pattern
+	})
+	return s
+}
+
+func (s *perOperationSampler) Sample(params SamplingParameters) SamplingDecision {
+	decision := s.samplerFor(params.Operation).Sample(params)
+	decision.Retryable = true
+	return decision
+}
+
+// samplerFor returns the sampler of an operation, creating it on first use
+// while fewer than maxOperations are tracked. Beyond that, it returns the
+// probabilistic sampler of the operation's rate.
+func (s *perOperationSampler) samplerFor(operation string) Sampler {
+	s.lock.RLock()
+	sampler, found := s.operations[operation]
+	s.lock.RUnlock()
+	if found {
+		return sampler
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if sampler, found = s.operations[operation]; found {
+		return sampler
+	}
+	rateSampler := s.rateSamplerOf(operation)
+	if len(s.operations) >= s.maxOperations {
+		return rateSampler
+	}
+	if s.minTracesPerSecond > 0 {
+		sampler = newGuaranteedThroughputSampler(s.minTracesPerSecond, rateSampler.rate)
+	} else {
+		sampler = newProbabilisticSampler(rateSampler.rate)
+	}
+	s.operations[operation] = sampler
+	return sampler
+}
+
+// rateSamplerOf returns the probabilistic sampler of the entry of Rates that
+// matches an operation, or of DefaultRate.
+func (s *perOperationSampler) rateSamplerOf(operation string) *probabilisticSampler {
+	if sampler, found := s.exact[operation]; found {
+		return sampler
+	}
+	for _, glob := range s.globs {
+		if matched, _ := path.Match(glob.pattern, operation); matched {
+			return glob.sampler
+		}
+	}
+	return s.defaultSampler
+}
+
+func isGlob(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package splunktracing
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+)
+
+var _ = Describe("NewPerOperationSampler", func() {
+	var sampler *perOperationSampler
+
+	rateOf := func(operation string) float64 {
+		return sampler.Sample(SamplingParameters{Operation: operation}).Tags[SamplerParamTagKey].(float64)
+	}
+
+	BeforeEach(func() {
+		sampler = newPerOperationSampler(PerOperationSamplerOptions{
+			DefaultRate: 0.5,
+			Rates: map[string]float64{
+				"GET /health":    0,
+				"GET /*":         0.1,
+				"GET /metrics*":  0.01,
+				"POST /checkout": 1,
+				"[invalid":       0.2,
+			},
+			MaxOperations: 5,
+		})
+	})
+
+	It("uses exact names before globs", func() {
+		Expect(rateOf("GET /health")).To(Equal(0.0))
+		Expect(rateOf("POST /checkout")).To(Equal(1.0))
+	})
+
+	It("prefers the longest matching glob", func() {
+		Expect(rateOf("GET /metrics")).To(Equal(0.01))
+		Expect(rateOf("GET /users")).To(Equal(0.1))
+	})
+
+	It("uses the default rate for unmatched operations", func() {
+		Expect(rateOf("DELETE /users")).To(Equal(0.5))
+	})
+
+	It("samples with the operation's probability", func() {
+		Expect(sampler.Sample(SamplingParameters{Operation: "POST /checkout", TraceID: maxRandomID}).Sampled).To(BeTrue())
+		Expect(sampler.Sample(SamplingParameters{Operation: "GET /health", TraceID: 0}).Sampled).To(BeFalse())
+	})
+
+	It("marks decisions as retryable", func() {
+		Expect(sampler.Sample(SamplingParameters{Operation: "x"}).Retryable).To(BeTrue())
+	})
+
+	It("stops tracking operations beyond the cap", func() {
+		for _, op := range []string{"a", "b", "c", "d", "e"} {
+			rateOf(op)
+		}
+		Expect(rateOf("POST /checkout")).To(Equal(1.0))
+		Expect(rateOf("GET /health")).To(Equal(0.0))
+		Expect(rateOf("GET /metrics-cpu")).To(Equal(0.01))
+		Expect(rateOf("DELETE /users")).To(Equal(0.5))
+		Expect(sampler.Sample(SamplingParameters{Operation: "GET /health", TraceID: 0}).Sampled).To(BeFalse())
+		Expect(sampler.operations).To(HaveLen(5))
+
+		// Operations tracked before the cap was reached keep their rate.
+		Expect(rateOf("a")).To(Equal(0.5))
+	})
+
+	Context("configured on a tracer", func() {
+		var tracer *tracerImpl
+		var recorder *countingRecorder
+
+		BeforeEach(func() {
+			recorder = &countingRecorder{}
+			tracer = newTestTracer(Options{
+				Recorder: recorder,
+				Sampler: NewPerOperationSampler(PerOperationSamplerOptions{
+					DefaultRate: 1,
+					Rates:       map[string]float64{"GET /health": 0},
+				}),
+			})
+		})
+
+		AfterEach(func() {
+			closeTestTracer(tracer)
+		})
+
+		It("samples again when a root span is renamed", func() {
+			sp := tracer.StartSpan("HTTP GET")
+			sp.SetOperationName("GET /health")
+			sp.Finish()
+			Expect(recorder.Spans()).To(BeEmpty())
+		})
+
+		It("keeps the decision once the context has been shared", func() {
+			sp := tracer.StartSpan("HTTP GET")
+			tracer.StartSpan("child", opentracing.ChildOf(sp.Context())).Finish()
+			sp.SetOperationName("GET /health")
+			sp.Finish()
+			Expect(recorder.Spans()).To(HaveLen(2))
+		})
+
+		It("counts each root span once, with its final decision", func() {
+			sp := tracer.StartSpan("HTTP GET")
+			sp.SetOperationName("GET /health")
+			sp.SetOperationName("GET /users")
+			sp.Finish()
+			report := tracer.postFlush(nil)
+			Expect(report.SampledTraces()).To(Equal(1))
+			Expect(report.RejectedTraces()).To(BeZero())
+		})
+	})
+})
+
+var _ = Describe("NewPerOperationSampler with MinTracesPerSecond", func() {
+	It("guarantees each operation its own lower bound", func() {
+		sampler := NewPerOperationSampler(PerOperationSamplerOptions{
+			DefaultRate:        0,
+			MinTracesPerSecond: 1,
+		})
+		rejected := func(op string) SamplingParameters {
+			return SamplingParameters{Operation: op, TraceID: maxRandomID}
+		}
+		Expect(sampler.Sample(rejected("a")).Sampled).To(BeTrue())
+		Expect(sampler.Sample(rejected("a")).Tags).To(HaveKeyWithValue(SamplerTypeTagKey, SamplerTypeLowerBound))
+		Expect(sampler.Sample(rejected("b")).Sampled).To(BeTrue())
+	})
+})
@@ -0,0 +1,207 @@
+package splunktracing
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// Sampler types reported in the SamplerTypeTagKey tag.
+const (
+	SamplerTypeRateLimiting = "ratelimiting"
+	SamplerTypeLowerBound   = "lowerbound"
+)
+
+// rateLimiter is a token bucket. It is refilled continuously at
+// creditsPerSecond and holds at most maxBalance credits, which bounds bursts.
+type rateLimiter struct {
+	sync.Mutex
+	creditsPerSecond float64
+	maxBalance       float64
+	balance          float64
+	lastTick         time.Time
+	now              func() time.Time
+}
+
+func newRateLimiter(creditsPerSecond, maxBalance float64) *rateLimiter {
+	return &rateLimiter{
+		creditsPerSecond: creditsPerSecond,
+		maxBalance:       maxBalance,
+		balance:          maxBalance,
+		lastTick:         time.Now(),
+		now:              time.Now,
+	}
+}
+
+// checkCredit withdraws cost credits if the balance allows it.
+func (r *rateLimiter) checkCredit(cost float64) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	now := r.now()
+	if elapsed := now.Sub(r.lastTick); elapsed > 0 {
+		r.balance = math.Min(r.maxBalance, r.balance+elapsed.Seconds()*r.creditsPerSecond)
+		r.lastTick = now
+	}
+	if r.balance < cost {
+		return false
+	}
+	r.balance -= cost
+	return true
+}
+
+// acceptanceTracker estimates the fraction of traces a sampler accepts,
+// over the current and the previous one-second window, so that the traces it
+// samples can be weighted.
+type acceptanceTracker struct {
+	sync.Mutex
+	windowStart time.Time
+	// previous and current window
+	seen     [2]float64
+	accepted [2]float64
+	now      func() time.Time
+}
+
+func newAcceptanceTracker() *acceptanceTracker {
+	return &acceptanceTracker{windowStart: time.Now(), now: time.Now}
+}
+
+// record counts a decision and returns the updated acceptance ratio.
+func (t *acceptanceTracker) record(accepted bool) float64 {
+	t.Lock()
+	defer t.Unlock()
+
+	t.rollLocked()
+	t.seen[1]++
+	if accepted {
+		t.accepted[1]++
+	}
+	return t.ratioLocked()
+}
+
+// ratio returns the acceptance ratio, or 0 if no decisions were recorded.
+func (t *acceptanceTracker) ratio() float64 {
+	t.Lock()
+	defer t.Unlock()
+
+	t.rollLocked()
+	return t.ratioLocked()
+}
+
+func (t *acceptanceTracker) rollLocked() {
+	now := t.now()
+	switch elapsed := now.Sub(t.windowStart); {
+	case elapsed >= 2*time.Second:
+		t.seen, t.accepted = [2]float64{}, [2]float64{}
+		t.windowStart = now
+	case elapsed >= time.Second:
+		t.seen = [2]float64{t.seen[1], 0}
+		t.accepted = [2]float64{t.accepted[1], 0}
+		t.windowStart = t.windowStart.Add(time.Second)
+	}
+}
+
+func (t *acceptanceTracker) ratioLocked() float64 {
+	seen := t.seen[0] + t.seen[1]
+	if seen == 0 {
+		return 0
+	}
+	return (t.accepted[0] + t.accepted[1]) / seen
+}
+
+type rateLimitingSampler struct {
+	limiter    *rateLimiter
+	acceptance *acceptanceTracker
+	tags       opentracing.Tags
+}
+
+// NewRateLimitingSampler returns a Sampler that records at most
+// tracesPerSecond new traces, using a token bucket that allows bursts of up
+// to burst traces. A burst below one defaults to max(tracesPerSecond, 1).
+// It is safe for concurrent use.
+func NewRateLimitingSampler(tracesPerSecond, burst float64) Sampler {
+	return newRateLimitingSampler(tracesPerSecond, burst)
+}
+
+func newRateLimitingSampler(tracesPerSecond, burst float64) *rateLimitingSampler {
+	if burst < 1 {
+		burst = math.Max(tracesPerSecond, 1)
+	}
+	return &rateLimitingSampler{
+		limiter:    newRateLimiter(tracesPerSecond, burst),
+		acceptance: newAcceptanceTracker(),
+		tags: opentracing.Tags{
+			SamplerTypeTagKey:  SamplerTypeRateLimiting,
+			SamplerParamTagKey: tracesPerSecond,
+		},
+	}
+}
+
+// Sample weights sampled traces by the fraction of recent traces that were
+// sampled.
+func (s *rateLimitingSampler) Sample(SamplingParameters) SamplingDecision {
+	sampled := s.limiter.checkCredit(1)
+	ratio := s.acceptance.record(sampled)
+	decision := SamplingDecision{
+		Sampled: sampled,
+		Tags:    s.tags,
+	}
+	if sampled {
+		decision.Weight = 1 / ratio
+	}
+	return decision
+}
+
+type guaranteedThroughputSampler struct {
+	probabilistic *probabilisticSampler
+	lowerBound    *rateLimitingSampler
+	lowerTags     opentracing.Tags
+}
+
+// NewGuaranteedThroughputSampler returns a Sampler that records traces with
+// the given probability, and also records up to minTracesPerSecond traces
+// that probability would reject, so that rare operations are still seen.
+// Traces sampled only to meet the lower bound are tagged with the
+// "lowerbound" sampler type.
+func NewGuaranteedThroughputSampler(minTracesPerSecond, rate float64) Sampler {
+	return newGuaranteedThroughputSampler(minTracesPerSecond, rate)
+}
+
+func newGuaranteedThroughputSampler(minTracesPerSecond, rate float64) *guaranteedThroughputSampler {
+	probabilistic := newProbabilisticSampler(rate)
+	return &guaranteedThroughputSampler{
+		probabilistic: probabilistic,
+		lowerBound:    newRateLimitingSampler(minTracesPerSecond, 0),
+		lowerTags: opentracing.Tags{
+			SamplerTypeTagKey:  SamplerTypeLowerBound,
+			SamplerParamTagKey: probabilistic.rate,
+		},
+	}
+}
+
+// Sample weights every sampled trace by the probability of being sampled
+// either way: rate, plus the lower bound's share of the remainder.
+func (s *guaranteedThroughputSampler) Sample(params SamplingParameters) SamplingDecision {
+	if decision := s.probabilistic.Sample(params); decision.Sampled {
+		// Traces sampled by probability count towards the lower bound too.
+		s.lowerBound.limiter.checkCredit(1)
+		decision.Weight = s.weight(s.lowerBound.acceptance.ratio())
+		return decision
+	}
+	lower := s.lowerBound.Sample(params)
+	decision := SamplingDecision{
+		Sampled: lower.Sampled,
+		Tags:    s.lowerTags,
+	}
+	if lower.Sampled {
+		decision.Weight = s.weight(s.lowerBound.acceptance.ratio())
+	}
+	return decision
+}
+
+func (s *guaranteedThroughputSampler) weight(lowerBoundRatio float64) float64 {
+	rate := s.probabilistic.rate
+	return 1 / (rate + (1-rate)*lowerBoundRatio)
+}
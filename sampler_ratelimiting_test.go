@@ -0,0 +1,154 @@
+package splunktracing
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rate-limiting samplers", func() {
+	var now time.Time
+	clock := func() time.Time { return now }
+
+	BeforeEach(func() {
+		now = time.Unix(1500000000, 0)
+	})
+
+	Describe("rateLimiter", func() {
+		It("allows a burst, then refills at the configured rate", func() {
+			limiter := newRateLimiter(2, 3)
+			limiter.now, limiter.lastTick = clock, now
+
+			for i := 0; i < 3; i++ {
+				Expect(limiter.checkCredit(1)).To(BeTrue())
+			}
+			Expect(limiter.checkCredit(1)).To(BeFalse())
+
+			now = now.Add(500 * time.Millisecond)
+			Expect(limiter.checkCredit(1)).To(BeTrue())
+			Expect(limiter.checkCredit(1)).To(BeFalse())
+
+			now = now.Add(time.Hour)
+			for i := 0; i < 3; i++ {
+				Expect(limiter.checkCredit(1)).To(BeTrue())
+			}
+			Expect(limiter.checkCredit(1)).To(BeFalse())
+		})
+
+		It("never grants more than the balance under concurrency", func() {
+			limiter := newRateLimiter(0, 100)
+			var granted int64
+			var wg sync.WaitGroup
+			for g := 0; g < 50; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 100; i++ {
+						if limiter.checkCredit(1) {
+							atomic.AddInt64(&granted, 1)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			Expect(granted).To(Equal(int64(100)))
+		})
+	})
+
+	Describe("NewRateLimitingSampler", func() {
+		It("records at most the configured number of traces", func() {
+			sampler := newRateLimitingSampler(1, 2)
+			sampler.limiter.now, sampler.limiter.lastTick = clock, now
+
+			Expect(sampler.Sample(SamplingParameters{}).Sampled).To(BeTrue())
+			Expect(sampler.Sample(SamplingParameters{}).Sampled).To(BeTrue())
+			Expect(sampler.Sample(SamplingParameters{}).Sampled).To(BeFalse())
+			Expect(sampler.Sample(SamplingParameters{}).Tags).To(HaveKeyWithValue(SamplerTypeTagKey, SamplerTypeRateLimiting))
+		})
+
+		It("weights sampled traces by the recent acceptance ratio", func() {
+			sampler := newRateLimitingSampler(1, 1)
+			sampler.limiter.now, sampler.limiter.lastTick = clock, now
+			sampler.acceptance.now, sampler.acceptance.windowStart = clock, now
+
+			Expect(sampler.Sample(SamplingParameters{}).Weight).To(Equal(1.0))
+			Expect(sampler.Sample(SamplingParameters{}).Sampled).To(BeFalse())
+			Expect(sampler.Sample(SamplingParameters{}).Sampled).To(BeFalse())
+
+			now = now.Add(time.Second)
+			Expect(sampler.Sample(SamplingParameters{}).Weight).To(Equal(2.0))
+
+			// Windows older than two seconds are forgotten.
+			now = now.Add(5 * time.Second)
+			Expect(sampler.Sample(SamplingParameters{}).Weight).To(Equal(1.0))
+		})
+	})
+
+	Describe("NewGuaranteedThroughputSampler", func() {
+		var sampler *guaranteedThroughputSampler
+
+		BeforeEach(func() {
+			sampler = newGuaranteedThroughputSampler(1, 0.5)
+			sampler.lowerBound.limiter.now, sampler.lowerBound.limiter.lastTick = clock, now
+		})
+
+		It("uses the probabilistic decision when it samples", func() {
+			decision := sampler.Sample(SamplingParameters{TraceID: 1})
+			Expect(decision.Sampled).To(BeTrue())
+			Expect(decision.Tags).To(HaveKeyWithValue(SamplerTypeTagKey, SamplerTypeProbabilistic))
+			Expect(decision.Weight).To(Equal(2.0))
+		})
+
+		It("weights traces by the chance of being sampled either way", func() {
+			sampler.lowerBound.acceptance.now, sampler.lowerBound.acceptance.windowStart = clock, now
+			rejected := SamplingParameters{TraceID: maxRandomID}
+			// The lower bound accepts the first of two rejected traces.
+			Expect(sampler.Sample(rejected).Weight).To(Equal(1.0))
+			Expect(sampler.Sample(rejected).Sampled).To(BeFalse())
+			Expect(sampler.Sample(SamplingParameters{TraceID: 1}).Weight).To(Equal(1 / (0.5 + 0.5*0.5)))
+		})
+
+		It("falls back to the lower bound", func() {
+			rejected := SamplingParameters{TraceID: maxRandomID}
+			decision := sampler.Sample(rejected)
+			Expect(decision.Sampled).To(BeTrue())
+			Expect(decision.Tags).To(HaveKeyWithValue(SamplerTypeTagKey, SamplerTypeLowerBound))
+			Expect(decision.Tags).To(HaveKeyWithValue(SamplerParamTagKey, 0.5))
+
+			Expect(sampler.Sample(rejected).Sampled).To(BeFalse())
+		})
+
+		It("counts probabilistic traces towards the lower bound", func() {
+			sampler.Sample(SamplingParameters{TraceID: 1})
+			Expect(sampler.Sample(SamplingParameters{TraceID: maxRandomID}).Sampled).To(BeFalse())
+		})
+	})
+
+	Context("configured on a tracer", func() {
+		var tracer *tracerImpl
+
+		BeforeEach(func() {
+			tracer = newTestTracer(Options{Sampler: NewRateLimitingSampler(0, 2)})
+		})
+
+		AfterEach(func() {
+			closeTestTracer(tracer)
+		})
+
+		It("reports sampled and rejected traces in the status report", func() {
+			for i := 0; i < 5; i++ {
+				tracer.StartSpan("root").Finish()
+			}
+			report := tracer.postFlush(nil)
+			Expect(report.SampledTraces()).To(Equal(2))
+			Expect(report.RejectedTraces()).To(Equal(3))
+
+			report = tracer.postFlush(nil)
+			Expect(report.SampledTraces()).To(BeZero())
+			Expect(report.RejectedTraces()).To(BeZero())
+		})
+	})
+})
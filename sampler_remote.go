@@ -0,0 +1,307 @@
+package splunktracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default RemoteSamplingOptions values.
+const (
+	DefaultRemoteSamplingPollInterval = time.Minute
+	DefaultRemoteSamplingTimeout      = 10 * time.Second
+)
+
+// maxSamplingStrategyBytes bounds the size of a strategy document. A larger
+// document is a configuration error.
+const maxSamplingStrategyBytes = 1 << 20
+
+// RemoteSamplingOptions configure polling of a sampling strategy document.
+//
+// The document may use the Jaeger sampling strategies format, e.g.
+//
+//	{"strategyType": "PROBABILISTIC", "probabilisticSampling": {"samplingRate": 0.01}}
+//	{"strategyType": "RATE_LIMITING", "rateLimitingSampling": {"maxTracesPerSecond": 50}}
+//	{"operationSampling": {"defaultSamplingProbability": 0.01,
+//	    "defaultLowerBoundTracesPerSecond": 0.1,
+//	    "perOperationStrategies": [{"operation": "GET /health",
+//	        "probabilisticSampling": {"samplingRate": 0}}]}}
+//
+// or the native format, whose type is one of "const", "probabilistic",
+// "ratelimiting" or "peroperation":
+//
+//	{"type": "probabilistic", "param": 0.01}
+//	{"type": "peroperation", "default_rate": 0.01, "rates": {"GET /health*": 0}}
+type RemoteSamplingOptions struct {
+	// URL of the strategy document. It is fetched with GET. A document over
+	// 1 MiB is rejected, and the last good strategy stays in effect.
+	URL string `yaml:"url"`
+
+	// ServiceName is sent as the `service` query parameter, as expected by
+	// Jaeger strategy endpoints. It defaults to the ComponentNameKey tag.
+	ServiceName string `yaml:"service_name"`
+
+	// PollInterval is the time between fetches. If zero,
+	// DefaultRemoteSamplingPollInterval is used.
+	PollInterval time.Duration `yaml:"poll_interval"`
+
+	// Timeout bounds each fetch. If zero, DefaultRemoteSamplingTimeout is
+	// used.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// remoteSampler delegates to the sampler built from the last good strategy
+// document. Until one is fetched, it delegates to the tracer's
+// Options.Sampler, or samples everything.
+type remoteSampler struct {
+	url          string
+	pollInterval time.Duration
+	client       *http.Client
+	maxBytes     int64
+
+	current atomic.Value // of remoteStrategy
+
+	// owned by the poll loop
+	lastDocument []byte
+
+	closeOnce sync.Once
+	closeChan chan struct{}
+	doneChan  chan struct{}
+}
+
+// remoteStrategy wraps the current sampler so that atomic.Value always
+// stores the same concrete type.
+type remoteStrategy struct {
+	sampler Sampler
+}
+
+func newRemoteSampler(opts RemoteSamplingOptions, serviceName string, initial Sampler) (*remoteSampler, error) {
+	target, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ServiceName != "" {
+		serviceName = opts.ServiceName
+	}
+	if serviceName != "" && target.Query().Get("service") == "" {
+		query := target.Query()
+		query.Set("service", serviceName)
+		target.RawQuery = query.Encode()
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultRemoteSamplingPollInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultRemoteSamplingTimeout
+	}
+
+	s := &remoteSampler{
+		url:          target.String(),
+		pollInterval: opts.PollInterval,
+		client:       &http.Client{Timeout: opts.Timeout},
+		maxBytes:     maxSamplingStrategyBytes,
+		closeChan:    make(chan struct{}),
+		doneChan:     make(chan struct{}),
+	}
+	s.current.Store(remoteStrategy{sampler: initial})
+	return s, nil
+}
+
+// activeSampler returns the sampler that Sample delegates to, which is nil
+// when it samples everything.
+func (s *remoteSampler) activeSampler() Sampler {
+	return s.current.Load().(remoteStrategy).sampler
+}
+
+func (s *remoteSampler) Sample(params SamplingParameters) SamplingDecision {
+	sampler := s.activeSampler()
+	if sampler == nil {
+		return SamplingDecision{Sampled: true}
+	}
+	return sampler.Sample(params)
+}
+
+// start polls the strategy document, fetching it once right away.
+func (s *remoteSampler) start() {
+	go func() {
+		defer close(s.doneChan)
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+		for {
+			s.poll()
+			select {
+			case <-ticker.C:
+			case <-s.closeChan:
+				return
+			}
+		}
+	}()
+}
+
+func (s *remoteSampler) close() {
+	s.closeOnce.Do(func() {
+		close(s.closeChan)
+		<-s.doneChan
+	})
+}
+
+// poll fetches the strategy document and applies it if it changed. On any
+// error, the last good strategy stays in effect.
+func (s *remoteSampler) poll() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.closeChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	document, err := s.fetch(ctx)
+	if err != nil {
+		emitEvent(newEventSamplingConfigError(err))
+		return
+	}
+	if bytes.Equal(document, s.lastDocument) {
+		return
+	}
+	sampler, description, err := parseSamplingStrategy(document)
+	if err != nil {
+		emitEvent(newEventSamplingConfigError(err))
+		return
+	}
+	s.current.Store(remoteStrategy{sampler: sampler})
+	s.lastDocument = document
+	emitEvent(newEventSamplingConfigChanged(description))
+}
+
+func (s *remoteSampler) fetch(ctx context.Context) ([]byte, error) {
+	request, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sampling strategy request returned status code (%d)", response.StatusCode)
+	}
+	document, err := ioutil.ReadAll(io.LimitReader(response.Body, s.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(document)) > s.maxBytes {
+		return nil, fmt.Errorf("sampling strategy document exceeds %d bytes", s.maxBytes)
+	}
+	return document, nil
+}
+
+type jaegerProbabilisticStrategy struct {
+	SamplingRate float64 `json:"samplingRate"`
+}
+
+type jaegerRateLimitingStrategy struct {
+	MaxTracesPerSecond float64 `json:"maxTracesPerSecond"`
+}
+
+type jaegerOperationStrategy struct {
+	Operation             string                       `json:"operation"`
+	ProbabilisticSampling *jaegerProbabilisticStrategy `json:"probabilisticSampling"`
+}
+
+type jaegerPerOperationStrategies struct {
+	DefaultSamplingProbability       float64                   `json:"defaultSamplingProbability"`
+	DefaultLowerBoundTracesPerSecond float64                   `json:"defaultLowerBoundTracesPerSecond"`
+	PerOperationStrategies           []jaegerOperationStrategy `json:"perOperationStrategies"`
+}
+
+// samplingStrategyDocument holds both document formats; the native format
+// is recognized by its "type" field.
+type samplingStrategyDocument struct {
+	// native format
+	Type string `json:"type"`
+	PerOperationSamplerOptions
+	Param *float64 `json:"param"`
+
+	// Jaeger format; strategyType is a name or, from older agents, a number,
+	// and is missing for PROBABILISTIC when proto-JSON omits its zero value
+	StrategyType          interface{}                   `json:"strategyType"`
+	ProbabilisticSampling *jaegerProbabilisticStrategy  `json:"probabilisticSampling"`
+	RateLimitingSampling  *jaegerRateLimitingStrategy   `json:"rateLimitingSampling"`
+	OperationSampling     *jaegerPerOperationStrategies `json:"operationSampling"`
+}
+
+// parseSamplingStrategy builds a sampler from a strategy document, along
+// with a description of it for EventSamplingConfigChanged.
+func parseSamplingStrategy(document []byte) (Sampler, string, error) {
+	var doc samplingStrategyDocument
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, "", fmt.Errorf("invalid sampling strategy document: %v", err)
+	}
+	if doc.Type != "" {
+		return doc.nativeSampler()
+	}
+	return doc.jaegerSampler()
+}
+
+func (doc *samplingStrategyDocument) nativeSampler() (Sampler, string, error) {
+	if doc.Type == SamplerTypePerOperation {
+		return NewPerOperationSampler(doc.PerOperationSamplerOptions),
+			fmt.Sprintf("%s %v (default %v)", doc.Type, doc.Rates, doc.DefaultRate), nil
+	}
+	if doc.Param == nil {
+		return nil, "", fmt.Errorf("sampling strategy %q has no param", doc.Type)
+	}
+	param := *doc.Param
+	description := fmt.Sprintf("%s %v", doc.Type, param)
+	switch doc.Type {
+	case SamplerTypeConst:
+		return NewConstSampler(param != 0), description, nil
+	case SamplerTypeProbabilistic:
+		return NewProbabilisticSampler(param), description, nil
+	case SamplerTypeRateLimiting:
+		return NewRateLimitingSampler(param, 0), description, nil
+	}
+	return nil, "", fmt.Errorf("unknown sampling strategy type %q", doc.Type)
+}
+
+func (doc *samplingStrategyDocument) jaegerSampler() (Sampler, string, error) {
+	if ops := doc.OperationSampling; ops != nil {
+		opts := PerOperationSamplerOptions{
+			DefaultRate:        ops.DefaultSamplingProbability,
+			Rates:              map[string]float64{},
+			MinTracesPerSecond: ops.DefaultLowerBoundTracesPerSecond,
+		}
+		for _, op := range ops.PerOperationStrategies {
+			if op.ProbabilisticSampling != nil {
+				opts.Rates[op.Operation] = op.ProbabilisticSampling.SamplingRate
+			}
+		}
+		return NewPerOperationSampler(opts),
+			fmt.Sprintf("%s %v (default %v, lower bound %v/s)", SamplerTypePerOperation, opts.Rates, opts.DefaultRate, opts.MinTracesPerSecond), nil
+	}
+	switch doc.StrategyType {
+	case "PROBABILISTIC", 0.0, nil:
+		if doc.ProbabilisticSampling != nil {
+			rate := doc.ProbabilisticSampling.SamplingRate
+			return NewProbabilisticSampler(rate), fmt.Sprintf("%s %v", SamplerTypeProbabilistic, rate), nil
+		}
+	case "RATE_LIMITING", 1.0:
+		if doc.RateLimitingSampling != nil {
+			rate := doc.RateLimitingSampling.MaxTracesPerSecond
+			return NewRateLimitingSampler(rate, 0), fmt.Sprintf("%s %v", SamplerTypeRateLimiting, rate), nil
+		}
+	}
+	return nil, "", fmt.Errorf("unsupported sampling strategy %v", doc.StrategyType)
+}
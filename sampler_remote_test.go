@@ -0,0 +1,220 @@
+package splunktracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Remote sampling", func() {
+	var server *httptest.Server
+	var lock sync.Mutex
+	var status int
+	var document string
+	var query string
+	var events <-chan Event
+
+	serve := func(code int, body string) {
+		lock.Lock()
+		defer lock.Unlock()
+		status, document = code, body
+	}
+
+	BeforeEach(func() {
+		var handler EventHandler
+		handler, events = NewEventChannel(10)
+		SetGlobalEventHandler(handler)
+
+		serve(http.StatusOK, `{"type": "const", "param": 0}`)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			query = r.URL.RawQuery
+			w.WriteHeader(status)
+			w.Write([]byte(document))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("remoteSampler", func() {
+		var sampler *remoteSampler
+
+		BeforeEach(func() {
+			var err error
+			sampler, err = newRemoteSampler(RemoteSamplingOptions{URL: server.URL}, "checkout", NewConstSampler(true))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("uses the initial sampler until a document is fetched", func() {
+			Expect(sampler.Sample(SamplingParameters{}).Sampled).To(BeTrue())
+		})
+
+		It("applies a fetched document and emits an event", func() {
+			sampler.poll()
+			Expect(sampler.Sample(SamplingParameters{}).Sampled).To(BeFalse())
+			lock.Lock()
+			Expect(query).To(Equal("service=checkout"))
+			lock.Unlock()
+
+			var event Event
+			Expect(events).To(Receive(&event))
+			Expect(event.(EventSamplingConfigChanged).Strategy()).To(Equal("const 0"))
+		})
+
+		It("emits an event only when the document changes", func() {
+			sampler.poll()
+			sampler.poll()
+			Expect(events).To(Receive())
+			Expect(events).NotTo(Receive())
+
+			serve(http.StatusOK, `{"type": "probabilistic", "param": 1}`)
+			sampler.poll()
+			Expect(sampler.Sample(SamplingParameters{}).Sampled).To(BeTrue())
+			Expect(events).To(Receive())
+		})
+
+		It("keeps the last good strategy on errors", func() {
+			sampler.poll()
+			Expect(events).To(Receive())
+
+			serve(http.StatusInternalServerError, "")
+			sampler.poll()
+			Expect(events).To(Receive(BeAssignableToTypeOf(&eventSamplingConfigError{})))
+
+			serve(http.StatusOK, `{"type": "bogus", "param": 1}`)
+			sampler.poll()
+			Expect(events).To(Receive(BeAssignableToTypeOf(&eventSamplingConfigError{})))
+
+			serve(http.StatusOK, `not json`)
+			sampler.poll()
+			Expect(events).To(Receive(BeAssignableToTypeOf(&eventSamplingConfigError{})))
+
+			Expect(sampler.Sample(SamplingParameters{}).Sampled).To(BeFalse())
+		})
+
+		It("rejects oversized documents", func() {
+			document := `{"type": "const", "param": 0}`
+			sampler.maxBytes = int64(len(document)) - 1
+			serve(http.StatusOK, document)
+			sampler.poll()
+			Expect(events).To(Receive(BeAssignableToTypeOf(&eventSamplingConfigError{})))
+			Expect(sampler.Sample(SamplingParameters{}).Sampled).To(BeTrue())
+
+			sampler.maxBytes = int64(len(document))
+			sampler.poll()
+			Expect(events).To(Receive(BeAssignableToTypeOf(&eventSamplingConfigChanged{})))
+			Expect(sampler.Sample(SamplingParameters{}).Sampled).To(BeFalse())
+		})
+
+		It("polls until closed", func() {
+			sampler.pollInterval = 10 * time.Millisecond
+			sampler.start()
+			Eventually(events).Should(Receive(BeAssignableToTypeOf(&eventSamplingConfigChanged{})))
+			serve(http.StatusOK, `{"type": "const", "param": 1}`)
+			Eventually(events).Should(Receive(BeAssignableToTypeOf(&eventSamplingConfigChanged{})))
+			sampler.close()
+			Expect(sampler.Sample(SamplingParameters{}).Sampled).To(BeTrue())
+		})
+	})
+
+	Describe("parseSamplingStrategy", func() {
+		parse := func(document string) Sampler {
+			sampler, _, err := parseSamplingStrategy([]byte(document))
+			Expect(err).NotTo(HaveOccurred())
+			return sampler
+		}
+
+		It("parses Jaeger probabilistic strategies", func() {
+			sampler := parse(`{"strategyType": "PROBABILISTIC", "probabilisticSampling": {"samplingRate": 0.25}}`)
+			Expect(sampler.Sample(SamplingParameters{}).Tags).To(HaveKeyWithValue(SamplerParamTagKey, 0.25))
+		})
+
+		It("parses numeric Jaeger strategy types", func() {
+			sampler := parse(`{"strategyType": 1, "rateLimitingSampling": {"maxTracesPerSecond": 5}}`)
+			Expect(sampler.Sample(SamplingParameters{}).Tags).To(HaveKeyWithValue(SamplerTypeTagKey, SamplerTypeRateLimiting))
+		})
+
+		It("parses Jaeger probabilistic strategies without a strategy type", func() {
+			sampler := parse(`{"probabilisticSampling": {"samplingRate": 0.25}}`)
+			Expect(sampler.Sample(SamplingParameters{}).Tags).To(HaveKeyWithValue(SamplerTypeTagKey, SamplerTypeProbabilistic))
+			Expect(sampler.Sample(SamplingParameters{}).Tags).To(HaveKeyWithValue(SamplerParamTagKey, 0.25))
+		})
+
+		It("parses Jaeger per-operation strategies", func() {
+			sampler := parse(`{
+				"strategyType": "PROBABILISTIC",
+				"probabilisticSampling": {"samplingRate": 1},
+				"operationSampling": {
+					"defaultSamplingProbability": 1,
+					"perOperationStrategies": [
+						{"operation": "GET /health", "probabilisticSampling": {"samplingRate": 0}}
+					]
+				}
+			}`)
+			Expect(sampler.Sample(SamplingParameters{Operation: "GET /health"}).Sampled).To(BeFalse())
+			Expect(sampler.Sample(SamplingParameters{Operation: "GET /users"}).Sampled).To(BeTrue())
+		})
+
+		It("parses native per-operation strategies", func() {
+			sampler := parse(`{"type": "peroperation", "default_rate": 1, "rates": {"GET /health*": 0}}`)
+			Expect(sampler.Sample(SamplingParameters{Operation: "GET /healthz"}).Sampled).To(BeFalse())
+		})
+
+		It("rejects incomplete documents", func() {
+			for _, document := range []string{
+				`{"type": "probabilistic"}`,
+				`{"strategyType": "PROBABILISTIC"}`,
+				`{"strategyType": "UNKNOWN"}`,
+				`{}`,
+			} {
+				_, _, err := parseSamplingStrategy([]byte(document))
+				Expect(err).To(HaveOccurred(), document)
+			}
+		})
+	})
+
+	Context("configured on a tracer", func() {
+		It("samples with the remote strategy and stops polling on Close", func() {
+			recorder := &countingRecorder{}
+			tracer := newTestTracer(Options{
+				Recorder:       recorder,
+				RemoteSampling: &RemoteSamplingOptions{URL: server.URL, PollInterval: time.Hour},
+			})
+			Eventually(events).Should(Receive(BeAssignableToTypeOf(&eventSamplingConfigChanged{})))
+			tracer.StartSpan("root").Finish()
+			Expect(recorder.Spans()).To(BeEmpty())
+
+			closeTestTracer(tracer)
+			Eventually(tracer.remoteSampler.doneChan).Should(BeClosed())
+		})
+
+		It("stops adapting Options.Sampler once a remote strategy replaces it", func() {
+			serve(http.StatusInternalServerError, "")
+			adaptive := NewAdaptiveSampler(AdaptiveSamplerOptions{})
+			tracer := newTestTracer(Options{
+				MinReportingPeriod: time.Hour,
+				Sampler:            adaptive,
+				RemoteSampling:     &RemoteSamplingOptions{URL: server.URL, PollInterval: time.Hour},
+			})
+			defer closeTestTracer(tracer)
+			Eventually(events).Should(Receive(BeAssignableToTypeOf(&eventSamplingConfigError{})))
+
+			Expect(tracer.activeFlushObserver()).To(BeIdenticalTo(adaptive))
+			Expect(tracer.preFlush()).To(BeNil())
+			Expect(tracer.postFlush(nil).SamplingRate()).To(Equal(1.0))
+
+			serve(http.StatusOK, `{"type": "const", "param": 1}`)
+			tracer.remoteSampler.poll()
+			Expect(tracer.activeFlushObserver()).To(BeNil())
+			Expect(tracer.preFlush()).To(BeNil())
+			Expect(tracer.postFlush(nil).SamplingRate()).To(BeZero())
+		})
+	})
+})
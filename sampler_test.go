@@ -0,0 +1,174 @@
+package splunktracing
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+var _ = Describe("Samplers", func() {
+	Describe("NewProbabilisticSampler", func() {
+		It("samples by trace ID", func() {
+			sampler := NewProbabilisticSampler(0.5)
+			Expect(sampler.Sample(SamplingParameters{TraceID: 1 << 61}).Sampled).To(BeTrue())
+			Expect(sampler.Sample(SamplingParameters{TraceID: 3 << 61}).Sampled).To(BeFalse())
+		})
+
+		It("makes the same decision for the same trace ID", func() {
+			a, b := NewProbabilisticSampler(0.25), NewProbabilisticSampler(0.25)
+			for i := 0; i < 1000; i++ {
+				id := genSeededGUID()
+				Expect(a.Sample(SamplingParameters{TraceID: id})).To(Equal(b.Sample(SamplingParameters{TraceID: id})))
+			}
+		})
+
+		It("ignores the top bit of IDs from other tracers", func() {
+			sampler := NewProbabilisticSampler(0.5)
+			Expect(sampler.Sample(SamplingParameters{TraceID: 1<<63 | 1}).Sampled).To(BeTrue())
+		})
+
+		It("samples roughly the configured fraction", func() {
+			sampler := NewProbabilisticSampler(0.1)
+			sampled := 0
+			for i := 0; i < 100000; i++ {
+				if sampler.Sample(SamplingParameters{TraceID: genSeededGUID()}).Sampled {
+					sampled++
+				}
+			}
+			Expect(sampled).To(BeNumerically("~", 10000, 1000))
+		})
+
+		It("clamps the rate and handles the extremes", func() {
+			Expect(NewProbabilisticSampler(2).Sample(SamplingParameters{TraceID: maxRandomID}).Sampled).To(BeTrue())
+			Expect(NewProbabilisticSampler(-1).Sample(SamplingParameters{TraceID: 0}).Sampled).To(BeFalse())
+		})
+
+		It("describes itself in tags", func() {
+			decision := NewProbabilisticSampler(0.5).Sample(SamplingParameters{})
+			Expect(decision.Tags).To(Equal(opentracing.Tags{
+				SamplerTypeTagKey:  SamplerTypeProbabilistic,
+				SamplerParamTagKey: 0.5,
+			}))
+		})
+
+		It("weights traces by the inverse of the rate", func() {
+			Expect(NewProbabilisticSampler(0.25).Sample(SamplingParameters{}).Weight).To(Equal(4.0))
+		})
+	})
+
+	Describe("NewConstSampler", func() {
+		It("always makes the same decision", func() {
+			Expect(NewConstSampler(true).Sample(SamplingParameters{}).Sampled).To(BeTrue())
+			Expect(NewConstSampler(false).Sample(SamplingParameters{}).Sampled).To(BeFalse())
+		})
+	})
+
+	Context("configured on a tracer", func() {
+		var tracer *tracerImpl
+		var recorder *countingRecorder
+
+		BeforeEach(func() {
+			recorder = &countingRecorder{}
+			tracer = newTestTracer(Options{Recorder: recorder, Sampler: NewConstSampler(false)})
+		})
+
+		AfterEach(func() {
+			closeTestTracer(tracer)
+		})
+
+		It("decides when the root span starts and children inherit the decision", func() {
+			root := tracer.StartSpan("root")
+			child := tracer.StartSpan("child", opentracing.ChildOf(root.Context()))
+			Expect(child.Context().(SpanContext).Sampled).To(BeFalse())
+			child.Finish()
+			root.Finish()
+			Expect(recorder.Spans()).To(BeEmpty())
+		})
+
+		It("keeps an upstream decision", func() {
+			parent := SpanContext{TraceID: 1, SpanID: 2, Sampled: true}
+			tracer.StartSpan("child", opentracing.ChildOf(parent)).Finish()
+			Expect(recorder.Spans()).To(HaveLen(1))
+			Expect(recorder.Spans()[0].Tags).NotTo(HaveKey(SamplerTypeTagKey))
+		})
+
+		It("forces sampling for a positive sampling.priority at start", func() {
+			root := tracer.StartSpan("root", opentracing.Tag{Key: string(ext.SamplingPriority), Value: 1})
+			child := tracer.StartSpan("child", opentracing.ChildOf(root.Context()))
+			Expect(child.Context().(SpanContext).Debug).To(BeTrue())
+			child.Finish()
+			root.Finish()
+			Expect(recorder.Spans()).To(HaveLen(2))
+		})
+
+		It("honors sampling.priority set after the span starts", func() {
+			tracer.sampler = NewConstSampler(true)
+			sp := tracer.StartSpan("root")
+			ext.SamplingPriority.Set(sp, 0)
+			Expect(sp.Context().(SpanContext).Sampled).To(BeFalse())
+			sp.Finish()
+
+			sp = tracer.StartSpan("root")
+			sp.SetTag(string(ext.SamplingPriority), "2")
+			Expect(sp.Context().(SpanContext).Debug).To(BeTrue())
+			sp.Finish()
+			Expect(recorder.Spans()).To(HaveLen(1))
+		})
+
+		It("starts a debug trace from a jaeger-debug-id header", func() {
+			carrier := opentracing.HTTPHeadersCarrier(http.Header{"Jaeger-Debug-Id": []string{"abc"}})
+			extracted, err := tracer.Extract(opentracing.HTTPHeaders, carrier)
+			Expect(err).NotTo(HaveOccurred())
+
+			sp := tracer.StartSpan("root", opentracing.ChildOf(extracted)).(*spanImpl)
+			Expect(sp.raw.Context.TraceID).NotTo(BeZero())
+			Expect(sp.raw.ParentSpanID).To(BeZero())
+			Expect(sp.raw.Context.Debug).To(BeTrue())
+			sp.Finish()
+			Expect(recorder.Spans()).To(HaveLen(1))
+
+			out := opentracing.TextMapCarrier{}
+			Expect(tracer.Inject(sp.Context(), opentracing.TextMap, out)).To(Succeed())
+			Expect(out[fieldNameDebug]).To(Equal("true"))
+		})
+
+		It("shares the sample weight across the trace", func() {
+			tracer.sampler = NewProbabilisticSampler(1)
+			root := tracer.StartSpan("root")
+			child := tracer.StartSpan("child", opentracing.ChildOf(root.Context()))
+			Expect(child.Context().(SpanContext).Sampling).To(Equal(SamplingInfo{
+				SamplerType:  SamplerTypeProbabilistic,
+				SamplerParam: 1.0,
+				Weight:       1,
+			}))
+		})
+
+		It("keeps the sample weight of a sampled trace on a forced child", func() {
+			parent := SpanContext{TraceID: 1, SpanID: 2, Sampled: true, Sampling: SamplingInfo{Weight: 4}}
+			child := tracer.StartSpan("child", opentracing.ChildOf(parent))
+			ext.SamplingPriority.Set(child, 1)
+			Expect(child.Context().(SpanContext).Sampling.Weight).To(Equal(4.0))
+
+			unsampled := SpanContext{TraceID: 1, SpanID: 2, Sampling: SamplingInfo{Weight: 4}}
+			child = tracer.StartSpan("child", opentracing.ChildOf(unsampled))
+			ext.SamplingPriority.Set(child, 1)
+			Expect(child.Context().(SpanContext).Sampling.Weight).To(Equal(1.0))
+
+			root := tracer.StartSpan("root", opentracing.Tag{Key: string(ext.SamplingPriority), Value: 1})
+			Expect(root.Context().(SpanContext).Sampling.Weight).To(Equal(1.0))
+		})
+
+		It("tags sampled root spans", func() {
+			tracer.sampler = NewProbabilisticSampler(1)
+			tracer.StartSpan("root", opentracing.Tag{Key: "k", Value: "v"}).Finish()
+			Expect(recorder.Spans()[0].Tags).To(Equal(opentracing.Tags{
+				"k":                "v",
+				SamplerTypeTagKey:  SamplerTypeProbabilistic,
+				SamplerParamTagKey: 1.0,
+			}))
+		})
+	})
+})
@@ -1,10 +1,12 @@
 package splunktracing
 
 import (
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/opentracing/opentracing-go/log"
 )
 
@@ -16,6 +18,15 @@ type spanImpl struct {
 	raw        RawSpan
 	// The number of logs dropped because of MaxLogsPerSpan.
 	numDroppedLogs int
+	// Whether SetOperationName may still revise the sampling decision. It
+	// is cleared once the span's context is handed out.
+	samplingRetryable bool
+	// Whether the tracer read the start time from its own clock, rather than
+	// taking an explicit StartTime.
+	tracerStartTime bool
+	// Whether the span has been finished. raw.Duration cannot tell, as it
+	// may be computed from explicit times that are out of order.
+	finished bool
 }
 
 func newSpan(operationName string, tracer *tracerImpl, sso []opentracing.StartSpanOption) *spanImpl {
@@ -23,36 +34,59 @@ func newSpan(operationName string, tracer *tracerImpl, sso []opentracing.StartSp
 
 	// Start time.
 	startTime := opts.Options.StartTime
-	if startTime.IsZero() {
+	tracerStartTime := startTime.IsZero()
+	if tracerStartTime {
 		startTime = time.Now()
 	}
 
 	// Build the new span. This is the only allocation: We'll return this as
 	// an opentracing.Span.
-	sp := &spanImpl{}
+	sp := &spanImpl{tracerStartTime: tracerStartTime}
+
+	// Root spans are sampled; children inherit their parent's decision.
+	sp.raw.Context.Sampled = true
 
 	// It's meaningless to provide either SpanID or ParentSpanID
 	// without also providing TraceID, so just test for TraceID.
 	if opts.SetTraceID != 0 {
 		sp.raw.Context.TraceID = opts.SetTraceID
+		sp.raw.Context.TraceIDHigh = opts.SetTraceIDHigh
 		sp.raw.Context.SpanID = opts.SetSpanID
 		sp.raw.ParentSpanID = opts.SetParentSpanID
 	}
 
-	// Look for a parent in the list of References.
-	//
-	// TODO: would be nice if we did something with all References, not just
-	//       the first one.
-ReferencesLoop:
+	// Record every reference; the first one is the parent.
+	hasParent := false
+	foundFirst := false
 	for _, ref := range opts.Options.References {
 		switch ref.Type {
 		case opentracing.ChildOfRef, opentracing.FollowsFromRef:
 			refCtx, ok := ref.ReferencedContext.(SpanContext)
 			if !ok {
-				break ReferencesLoop
+				continue
+			}
+			if refCtx.TraceID != 0 {
+				sp.raw.References = append(sp.raw.References, SpanReference{
+					Type:        ref.Type,
+					TraceID:     refCtx.TraceID,
+					TraceIDHigh: refCtx.TraceIDHigh,
+					SpanID:      refCtx.SpanID,
+				})
+			}
+			if foundFirst {
+				continue
 			}
+			foundFirst = true
+
 			sp.raw.Context.TraceID = refCtx.TraceID
+			sp.raw.Context.TraceIDHigh = refCtx.TraceIDHigh
 			sp.raw.ParentSpanID = refCtx.SpanID
+			sp.raw.Context.Sampled = refCtx.Sampled
+			sp.raw.Context.Debug = refCtx.Debug
+			sp.raw.Context.Sampling = refCtx.Sampling
+			// A context without a TraceID only carries a debug request, such
+			// as an extracted jaeger-debug-id header; the span is a root.
+			hasParent = refCtx.TraceID != 0
 
 			if l := len(refCtx.Baggage); l > 0 {
 				sp.raw.Context.Baggage = make(map[string]string, l)
@@ -60,13 +94,17 @@ ReferencesLoop:
 					sp.raw.Context.Baggage[k] = v
 				}
 			}
-			break ReferencesLoop
+			// The properties map is never changed in place, only replaced.
+			sp.raw.Context.BaggageProperties = refCtx.BaggageProperties
 		}
 	}
 
 	if sp.raw.Context.TraceID == 0 {
 		// TraceID not set by parent reference or explicitly
 		sp.raw.Context.TraceID, sp.raw.Context.SpanID = genSeededGUID2()
+		if tracer.opts.Use128BitTraceID {
+			sp.raw.Context.TraceIDHigh = genSeededGUID()
+		}
 	} else if sp.raw.Context.SpanID == 0 {
 		// TraceID set but SpanID not set
 		sp.raw.Context.SpanID = genSeededGUID()
@@ -76,7 +114,34 @@ ReferencesLoop:
 	sp.raw.Operation = operationName
 	sp.raw.Start = startTime
 	sp.raw.Duration = -1
-	sp.raw.Tags = opts.Options.Tags
+	if len(opts.Options.Tags) > 0 {
+		sp.raw.Tags = make(opentracing.Tags, len(opts.Options.Tags))
+		for key, value := range opts.Options.Tags {
+			sp.setTag(key, value)
+		}
+	}
+	sp.raw.Links = opts.Links
+
+	// The sampling decision for a trace is made when its root span starts.
+	// Debug traces bypass the sampler, and sampling.priority overrides it.
+	if !hasParent && tracer.sampler != nil {
+		if !sp.raw.Context.Debug {
+			sp.sample()
+		}
+		if !sp.samplingRetryable {
+			tracer.countSamplingDecision(sp.raw.Context.Sampled)
+		}
+	}
+	if priority, found := sp.raw.Tags[string(ext.SamplingPriority)]; found {
+		sp.applySamplingPriority(priority)
+	}
+
+	for _, processor := range tracer.processors {
+		processor.OnStart(sp)
+	}
+	if !sp.IsMeta() {
+		tracer.openSpans.add(sp)
+	}
 
 	if tracer.opts.MetaEventReportingEnabled && !sp.IsMeta() {
 		opentracing.StartSpan(SPLMetaEvent_SpanStartOperation,
@@ -88,24 +153,142 @@ ReferencesLoop:
 	return sp
 }
 
+// sample asks the tracer's Sampler for a decision on this root span. The
+// caller must hold the span's lock, or own the span exclusively.
+func (s *spanImpl) sample() {
+	decision := s.tracer.sampler.Sample(SamplingParameters{
+		TraceID:     s.raw.Context.TraceID,
+		TraceIDHigh: s.raw.Context.TraceIDHigh,
+		Operation:   s.raw.Operation,
+	})
+	s.raw.Context.Sampled = decision.Sampled
+	s.raw.Context.Sampling = SamplingInfo{Weight: decision.Weight}
+	s.raw.Context.Sampling.SamplerType, _ = decision.Tags[SamplerTypeTagKey].(string)
+	s.raw.Context.Sampling.SamplerParam = decision.Tags[SamplerParamTagKey]
+	s.samplingRetryable = decision.Retryable
+	if len(decision.Tags) > 0 && s.raw.Tags == nil {
+		s.raw.Tags = make(opentracing.Tags, len(decision.Tags))
+	}
+	for k, v := range decision.Tags {
+		s.raw.Tags[k] = v
+	}
+}
+
 func (s *spanImpl) SetOperationName(operationName string) opentracing.Span {
 	s.Lock()
 	defer s.Unlock()
 	s.raw.Operation = operationName
+	if s.samplingRetryable && !s.raw.Context.Debug {
+		s.sample()
+		if !s.samplingRetryable {
+			s.tracer.countSamplingDecision(s.raw.Context.Sampled)
+		}
+	}
 	return s
 }
 
+// finalizeSampling makes a retryable sampling decision final. The caller must
+// hold the span's lock.
+func (s *spanImpl) finalizeSampling() {
+	if s.samplingRetryable {
+		s.samplingRetryable = false
+		s.tracer.countSamplingDecision(s.raw.Context.Sampled)
+	}
+}
+
 func (s *spanImpl) SetTag(key string, value interface{}) opentracing.Span {
 	s.Lock()
 	defer s.Unlock()
 
-	if s.raw.Tags == nil {
-		s.raw.Tags = opentracing.Tags{}
+	s.setTag(key, value)
+	if key == string(ext.SamplingPriority) {
+		s.applySamplingPriority(value)
 	}
-	s.raw.Tags[key] = value
 	return s
 }
 
+// setTag sets a tag within the tracer's MaxTagsPerSpan, MaxTagKeyLen and
+// MaxTagValueLen limits. The caller must hold the span's lock, or own the
+// span exclusively.
+func (s *spanImpl) setTag(key string, value interface{}) {
+	setRawTag(&s.raw, &s.tracer.opts, key, value)
+}
+
+// setRawTag sets a tag of raw within the limits of opts.
+func setRawTag(raw *RawSpan, opts *Options, key string, value interface{}) {
+	key = truncateWithEllipsis(key, opts.MaxTagKeyLen)
+	if str, ok := value.(string); ok {
+		value = truncateWithEllipsis(str, opts.MaxTagValueLen)
+	}
+
+	if raw.Tags == nil {
+		raw.Tags = opentracing.Tags{}
+	}
+	if _, found := raw.Tags[key]; !found && opts.MaxTagsPerSpan > 0 && len(raw.Tags) >= opts.MaxTagsPerSpan {
+		raw.DroppedTagsCount++
+		return
+	}
+	raw.Tags[key] = value
+}
+
+// tagBaggage sets the baggage items named by Options.BaggageTagKeys as tags
+// of raw, unless they are tagged already.
+func (s *spanImpl) tagBaggage(raw *RawSpan) {
+	for _, key := range s.tracer.opts.BaggageTagKeys {
+		if val, found := lookupBaggageItem(raw.Context.Baggage, key); found {
+			if _, tagged := raw.Tags[key]; !tagged {
+				setRawTag(raw, &s.tracer.opts, key, val)
+			}
+		}
+	}
+}
+
+// applySamplingPriority forces the span into, or out of, sampling as
+// requested by a sampling.priority tag: a positive priority makes the trace a
+// debug trace, zero drops it. The caller must hold the span's lock, or own
+// the span exclusively.
+func (s *spanImpl) applySamplingPriority(value interface{}) {
+	priority, ok := samplingPriority(value)
+	if !ok {
+		return
+	}
+	wasSampled := s.raw.Context.Sampled
+	s.raw.Context.Sampled = priority > 0
+	s.raw.Context.Debug = priority > 0
+	if s.raw.ParentSpanID == 0 || !wasSampled {
+		// A forced trace stands only for itself. A trace that was already
+		// sampled keeps the weight its other spans report.
+		s.raw.Context.Sampling.Weight = 1
+	}
+	s.finalizeSampling()
+}
+
+// samplingPriority reads the value of a sampling.priority tag, which
+// ext.SamplingPriority sets as a uint16 but callers often set as an int or a
+// string.
+func samplingPriority(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case uint16:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case string:
+		priority, err := strconv.ParseInt(v, 10, 64)
+		return priority, err == nil
+	}
+	return 0, false
+}
+
 func (s *spanImpl) LogKV(keyValues ...interface{}) {
 	fields, err := log.InterleavedKVToFields(keyValues...)
 	if err != nil {
@@ -136,7 +319,7 @@ func (s *spanImpl) LogFields(fields ...log.Field) {
 	}
 	s.Lock()
 	defer s.Unlock()
-	if s.tracer.opts.DropSpanLogs {
+	if s.tracer.opts.DropSpanLogs || !s.raw.Context.Sampled {
 		return
 	}
 	if lr.Timestamp.IsZero() {
@@ -161,7 +344,7 @@ func (s *spanImpl) LogEventWithPayload(event string, payload interface{}) {
 func (s *spanImpl) Log(ld opentracing.LogData) {
 	s.Lock()
 	defer s.Unlock()
-	if s.tracer.opts.DropSpanLogs {
+	if s.tracer.opts.DropSpanLogs || !s.raw.Context.Sampled {
 		return
 	}
 
@@ -176,6 +359,33 @@ func (s *spanImpl) Finish() {
 	s.FinishWithOptions(opentracing.FinishOptions{})
 }
 
+// decircularizeLogs puts logs, a span's log buffer after numDroppedLogs logs
+// were dropped from it, back in order.
+func decircularizeLogs(logs []opentracing.LogRecord, numDroppedLogs int) {
+	if numDroppedLogs == 0 {
+		return
+	}
+	// We dropped some log events, which means that we used part of Logs as a
+	// circular buffer (see appendLog). De-circularize it.
+	numOld := (len(logs) - 1) / 2
+	numNew := len(logs) - numOld
+	rotateLogBuffer(logs[numOld:], numDroppedLogs%numNew)
+
+	// Replace the log in the middle (the oldest "new" log) with information
+	// about the dropped logs. This means that we are effectively dropping one
+	// more "new" log.
+	numDropped := numDroppedLogs + 1
+	logs[numOld] = opentracing.LogRecord{
+		// Keep the timestamp of the last dropped event.
+		Timestamp: logs[numOld].Timestamp,
+		Fields: []log.Field{
+			log.String("event", "dropped Span logs"),
+			log.Int("dropped_log_count", numDropped),
+			log.String("component", "basictracer"),
+		},
+	}
+}
+
 // rotateLogBuffer rotates the records in the buffer: records 0 to pos-1 move at
 // the end (i.e. pos circular left shifts).
 func rotateLogBuffer(buf []opentracing.LogRecord, pos int) {
@@ -194,18 +404,52 @@ func rotateLogBuffer(buf []opentracing.LogRecord, pos int) {
 }
 
 func (s *spanImpl) FinishWithOptions(opts opentracing.FinishOptions) {
-	finishTime := opts.FinishTime
-	if finishTime.IsZero() {
-		finishTime = time.Now()
+	var duration time.Duration
+	if opts.FinishTime.IsZero() && s.tracerStartTime {
+		// Both times come from this process, so the monotonic clock measures
+		// the duration, unaffected by steps of the wall clock.
+		duration = time.Since(s.raw.Start)
+	} else {
+		finishTime := opts.FinishTime
+		if finishTime.IsZero() {
+			finishTime = time.Now()
+		}
+		duration = finishTime.Sub(s.raw.Start)
 	}
-	duration := finishTime.Sub(s.raw.Start)
+
+	// The skew is reported once the span is unlocked, so that a handler can
+	// use the span.
+	var skew *eventClockSkew
+	defer func() {
+		if skew != nil {
+			emitEvent(skew)
+		}
+	}()
 
 	s.Lock()
 	defer s.Unlock()
 
-	// If the duration is already set, this span has already been finished.
-	// Return so we don't double submit the span.
-	if s.raw.Duration >= 0 {
+	// Return if this span has already been finished, so we don't double
+	// submit it.
+	if s.finished {
+		return
+	}
+	s.finished = true
+	s.tracer.openSpans.remove(s)
+
+	if duration < 0 {
+		// The explicit start or finish time came from a clock that is
+		// ahead of the other one.
+		s.raw.ClockSkew = -duration
+		duration = 0
+		skew = newEventClockSkew(s.raw.Operation, s.raw.ClockSkew)
+	}
+
+	s.finalizeSampling()
+	if !s.raw.Context.Sampled {
+		// Nothing is buffered or recorded for unsampled spans; just mark the
+		// span as finished.
+		s.raw.Duration = duration
 		return
 	}
 
@@ -216,27 +460,9 @@ func (s *spanImpl) FinishWithOptions(opts opentracing.FinishOptions) {
 		s.appendLog(ld.ToLogRecord())
 	}
 
-	if s.numDroppedLogs > 0 {
-		// We dropped some log events, which means that we used part of Logs as a
-		// circular buffer (see appendLog). De-circularize it.
-		numOld := (len(s.raw.Logs) - 1) / 2
-		numNew := len(s.raw.Logs) - numOld
-		rotateLogBuffer(s.raw.Logs[numOld:], s.numDroppedLogs%numNew)
-
-		// Replace the log in the middle (the oldest "new" log) with information
-		// about the dropped logs. This means that we are effectively dropping one
-		// more "new" log.
-		numDropped := s.numDroppedLogs + 1
-		s.raw.Logs[numOld] = opentracing.LogRecord{
-			// Keep the timestamp of the last dropped event.
-			Timestamp: s.raw.Logs[numOld].Timestamp,
-			Fields: []log.Field{
-				log.String("event", "dropped Span logs"),
-				log.Int("dropped_log_count", numDropped),
-				log.String("component", "basictracer"),
-			},
-		}
-	}
+	decircularizeLogs(s.raw.Logs, s.numDroppedLogs)
+
+	s.tagBaggage(&s.raw)
 
 	s.raw.Duration = duration
 
@@ -255,17 +481,41 @@ func (s *spanImpl) Tracer() opentracing.Tracer {
 }
 
 func (s *spanImpl) Context() opentracing.SpanContext {
+	s.Lock()
+	defer s.Unlock()
+	// Once the context is shared, children and downstream services rely on
+	// the sampling decision, so it can no longer change.
+	s.finalizeSampling()
 	return s.raw.Context
 }
 
 func (s *spanImpl) SetBaggageItem(key, val string) opentracing.Span {
-
 	s.Lock()
-	defer s.Unlock()
+	if err := s.tracer.baggageLimits.check(s.raw.Context.Baggage, key, val); err != nil {
+		s.Unlock()
+		emitEvent(newEventBaggageDropped(1, err))
+		return s
+	}
 	s.raw.Context = s.raw.Context.WithBaggageItem(key, val)
+	s.Unlock()
 	return s
 }
 
+// AddLink links the span to the span of sc, like the WithLink start option.
+// Links added to unsampled spans are discarded.
+func (s *spanImpl) AddLink(sc opentracing.SpanContext, attributes opentracing.Tags) {
+	link, ok := newSpanLink(sc, attributes)
+	if !ok {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if !s.raw.Context.Sampled {
+		return
+	}
+	s.raw.Links = append(s.raw.Links, link)
+}
+
 func (s *spanImpl) BaggageItem(key string) string {
 	s.Lock()
 	defer s.Unlock()
@@ -0,0 +1,137 @@
+package splunktracing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// A SpanProcessor is a stage in the tracer's span pipeline, see
+// Options.SpanProcessors. Processors are called synchronously, from the
+// goroutines that start and finish spans, and must be safe for concurrent
+// use. Wrap a slow processor with NewAsyncSpanProcessor.
+type SpanProcessor interface {
+	// OnStart is called when a span starts, after sampling. The processor
+	// may set tags or baggage on the span.
+	OnStart(span opentracing.Span)
+
+	// OnFinish is called when a sampled span finishes. It returns the span
+	// to pass to the next stage, possibly changed, or false to drop it.
+	OnFinish(raw RawSpan) (RawSpan, bool)
+}
+
+// spanProcessorCloser is implemented by processors that hold resources,
+// such as the goroutine of NewAsyncSpanProcessor. Tracer.Close closes them.
+type spanProcessorCloser interface {
+	Close(ctx context.Context)
+}
+
+// reportingProcessor is the stage that sends spans to Splunk, through the
+// tail-sampling stage if it is enabled.
+type reportingProcessor struct {
+	tracer *tracerImpl
+}
+
+func (p reportingProcessor) OnStart(opentracing.Span) {}
+
+func (p reportingProcessor) OnFinish(raw RawSpan) (RawSpan, bool) {
+	tracer := p.tracer
+	if tracer.tailSampler != nil {
+		tracer.tailSampler.add(raw, time.Now())
+		return raw, true
+	}
+	tracer.lock.Lock()
+	if !tracer.disabled {
+		tracer.buffer.addSpan(raw)
+	}
+	tracer.lock.Unlock()
+	return raw, true
+}
+
+type spanRecorderProcessor struct {
+	recorder SpanRecorder
+}
+
+// NewSpanRecorderProcessor adapts a SpanRecorder to a SpanProcessor that
+// records every span that reaches it and passes it on unchanged. The
+// Options.Recorder is run this way, after the reporting stage.
+func NewSpanRecorderProcessor(recorder SpanRecorder) SpanProcessor {
+	return spanRecorderProcessor{recorder: recorder}
+}
+
+func (p spanRecorderProcessor) OnStart(opentracing.Span) {}
+
+func (p spanRecorderProcessor) OnFinish(raw RawSpan) (RawSpan, bool) {
+	p.recorder.RecordSpan(raw)
+	return raw, true
+}
+
+type asyncSpanProcessor struct {
+	processor SpanProcessor
+	queue     chan RawSpan
+	doneChan  chan struct{}
+
+	// lock guards queue against sends after Close.
+	lock   sync.RWMutex
+	closed bool
+}
+
+// NewAsyncSpanProcessor runs the OnFinish of processor on a goroutine of its
+// own, fed by a queue of queueSize spans, so that a slow processor such as an
+// exporter does not hold up finishing spans. Spans are passed on to the next
+// stage right away, unchanged: processor can observe spans but neither change
+// nor drop them. It gets a copy of each span, which the next stages cannot
+// change under it. When the queue is full, processor misses the span. OnStart
+// still runs synchronously. Tracer.Close drains the queue.
+func NewAsyncSpanProcessor(processor SpanProcessor, queueSize int) SpanProcessor {
+	p := &asyncSpanProcessor{
+		processor: processor,
+		queue:     make(chan RawSpan, queueSize),
+		doneChan:  make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *asyncSpanProcessor) run() {
+	defer close(p.doneChan)
+	for raw := range p.queue {
+		p.processor.OnFinish(raw)
+	}
+}
+
+func (p *asyncSpanProcessor) OnStart(span opentracing.Span) {
+	p.processor.OnStart(span)
+}
+
+func (p *asyncSpanProcessor) OnFinish(raw RawSpan) (RawSpan, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if !p.closed {
+		select {
+		case p.queue <- copyRawSpan(raw):
+		default:
+		}
+	}
+	return raw, true
+}
+
+// Close stops accepting spans and waits until the queued ones are processed,
+// or ctx is done.
+func (p *asyncSpanProcessor) Close(ctx context.Context) {
+	p.lock.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.lock.Unlock()
+	select {
+	case <-p.doneChan:
+	case <-ctx.Done():
+	}
+	if closer, ok := p.processor.(spanProcessorCloser); ok {
+		closer.Close(ctx)
+	}
+}
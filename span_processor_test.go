@@ -0,0 +1,195 @@
+package splunktracing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// funcProcessor is a SpanProcessor built from functions, for tests.
+type funcProcessor struct {
+	onStart  func(opentracing.Span)
+	onFinish func(RawSpan) (RawSpan, bool)
+}
+
+func (p funcProcessor) OnStart(span opentracing.Span) {
+	if p.onStart != nil {
+		p.onStart(span)
+	}
+}
+
+func (p funcProcessor) OnFinish(raw RawSpan) (RawSpan, bool) {
+	if p.onFinish != nil {
+		return p.onFinish(raw)
+	}
+	return raw, true
+}
+
+var _ = Describe("SpanProcessors", func() {
+	var tracer *tracerImpl
+	var opts Options
+	var recorder *countingRecorder
+
+	BeforeEach(func() {
+		tracer = nil
+		recorder = &countingRecorder{}
+		opts = Options{Recorder: recorder, MinReportingPeriod: time.Hour}
+	})
+
+	AfterEach(func() {
+		if tracer != nil {
+			closeTestTracer(tracer)
+		}
+	})
+
+	It("runs processors in order before reporting and recording", func() {
+		var calls []string
+		opts.SpanProcessors = []SpanProcessor{
+			funcProcessor{
+				onStart: func(span opentracing.Span) {
+					calls = append(calls, "first start")
+					span.SetTag("team", "payments")
+				},
+				onFinish: func(raw RawSpan) (RawSpan, bool) {
+					calls = append(calls, "first finish")
+					raw.Tags["enriched"] = true
+					return raw, true
+				},
+			},
+			funcProcessor{
+				onStart: func(opentracing.Span) { calls = append(calls, "second start") },
+				onFinish: func(raw RawSpan) (RawSpan, bool) {
+					calls = append(calls, "second finish")
+					Expect(raw.Tags).To(HaveKey("enriched"))
+					return raw, true
+				},
+			},
+		}
+		tracer = newTestTracer(opts)
+
+		tracer.StartSpan("op").Finish()
+		Expect(calls).To(Equal([]string{"first start", "second start", "first finish", "second finish"}))
+		Expect(recorder.Spans()[0].Tags).To(Equal(opentracing.Tags{"team": "payments", "enriched": true}))
+		Expect(tracer.buffer.rawSpans).To(HaveLen(1))
+	})
+
+	It("lets a processor drop spans", func() {
+		opts.SpanProcessors = []SpanProcessor{funcProcessor{
+			onFinish: func(raw RawSpan) (RawSpan, bool) {
+				return raw, raw.Operation != "health"
+			},
+		}}
+		tracer = newTestTracer(opts)
+
+		tracer.StartSpan("health").Finish()
+		tracer.StartSpan("checkout").Finish()
+		Expect(recorder.Spans()).To(HaveLen(1))
+		Expect(tracer.buffer.rawSpans).To(HaveLen(1))
+		Expect(tracer.buffer.rawSpans[0].Operation).To(Equal("checkout"))
+	})
+
+	It("only finishes sampled spans", func() {
+		var started, finished int
+		opts.SpanProcessors = []SpanProcessor{funcProcessor{
+			onStart: func(opentracing.Span) { started++ },
+			onFinish: func(raw RawSpan) (RawSpan, bool) {
+				finished++
+				return raw, true
+			},
+		}}
+		tracer = newTestTracer(opts)
+
+		tracer.StartSpan("op", opentracing.ChildOf(SpanContext{TraceID: 1, SpanID: 2})).Finish()
+		Expect(started).To(Equal(1))
+		Expect(finished).To(BeZero())
+	})
+
+	Describe("NewAsyncSpanProcessor", func() {
+		It("processes spans on its own goroutine and drains on close", func() {
+			var lock sync.Mutex
+			var seen []string
+			release := make(chan struct{})
+			async := NewAsyncSpanProcessor(funcProcessor{
+				onFinish: func(raw RawSpan) (RawSpan, bool) {
+					<-release
+					lock.Lock()
+					defer lock.Unlock()
+					seen = append(seen, raw.Operation)
+					return raw, false
+				},
+			}, 10)
+
+			for _, op := range []string{"a", "b"} {
+				raw, keep := async.OnFinish(RawSpan{Operation: op})
+				Expect(keep).To(BeTrue())
+				Expect(raw.Operation).To(Equal(op))
+			}
+			close(release)
+			async.(spanProcessorCloser).Close(context.Background())
+			Expect(seen).To(Equal([]string{"a", "b"}))
+
+			// Spans finished after close are ignored.
+			_, keep := async.OnFinish(RawSpan{Operation: "c"})
+			Expect(keep).To(BeTrue())
+		})
+
+		It("skips spans when its queue is full", func() {
+			release := make(chan struct{})
+			var count int
+			async := NewAsyncSpanProcessor(funcProcessor{
+				onFinish: func(raw RawSpan) (RawSpan, bool) {
+					<-release
+					count++
+					return raw, true
+				},
+			}, 1)
+
+			// One span is being processed, one is queued, the rest are skipped.
+			async.OnFinish(RawSpan{})
+			Eventually(func() int { return len(async.(*asyncSpanProcessor).queue) }).Should(BeZero())
+			for i := 0; i < 5; i++ {
+				async.OnFinish(RawSpan{})
+			}
+			close(release)
+			async.(spanProcessorCloser).Close(context.Background())
+			Expect(count).To(Equal(2))
+		})
+
+		It("gets copies that the next stages cannot change", func() {
+			release := make(chan struct{})
+			var seen RawSpan
+			opts.SpanProcessors = []SpanProcessor{
+				NewAsyncSpanProcessor(funcProcessor{
+					onFinish: func(raw RawSpan) (RawSpan, bool) {
+						<-release
+						seen = raw
+						return raw, true
+					},
+				}, 10),
+				funcProcessor{
+					onFinish: func(raw RawSpan) (RawSpan, bool) {
+						raw.Tags["enriched"] = true
+						raw.Logs[0].Fields[0] = log.String("event", "changed")
+						return raw, true
+					},
+				},
+			}
+			tracer = newTestTracer(opts)
+
+			sp := tracer.StartSpan("op", opentracing.Tag{Key: "k", Value: "v"})
+			sp.LogFields(log.String("event", "original"))
+			sp.Finish()
+			close(release)
+			closeTestTracer(tracer)
+			tracer = nil
+
+			Expect(seen.Tags).To(Equal(opentracing.Tags{"k": "v"}))
+			Expect(seen.Logs[0].Fields).To(Equal([]log.Field{log.String("event", "original")}))
+		})
+	})
+})
@@ -0,0 +1,251 @@
+package splunktracing
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+)
+
+type countingRecorder struct {
+	sync.Mutex
+	spans []RawSpan
+}
+
+func (r *countingRecorder) RecordSpan(raw RawSpan) {
+	r.Lock()
+	defer r.Unlock()
+	r.spans = append(r.spans, raw)
+}
+
+func (r *countingRecorder) Spans() []RawSpan {
+	r.Lock()
+	defer r.Unlock()
+	return append([]RawSpan(nil), r.spans...)
+}
+
+var _ = Describe("newSpan", func() {
+	var tracer *tracerImpl
+	var opts Options
+	var recorder *countingRecorder
+
+	BeforeEach(func() {
+		recorder = &countingRecorder{}
+		opts = Options{Recorder: recorder}
+	})
+
+	JustBeforeEach(func() {
+		tracer = newTestTracer(opts)
+	})
+
+	AfterEach(func() {
+		closeTestTracer(tracer)
+	})
+
+	Describe("trace IDs", func() {
+		It("starts 64-bit traces by default", func() {
+			sc := tracer.StartSpan("root").Context().(SpanContext)
+			Expect(sc.TraceID).NotTo(BeZero())
+			Expect(sc.TraceIDHigh).To(BeZero())
+		})
+
+		Context("when Use128BitTraceID is set", func() {
+			BeforeEach(func() {
+				opts.Use128BitTraceID = true
+			})
+
+			It("starts 128-bit traces", func() {
+				sc := tracer.StartSpan("root").Context().(SpanContext)
+				Expect(sc.TraceIDHigh).NotTo(BeZero())
+				Expect(sc.TraceIDHex()).To(HaveLen(32))
+			})
+
+			It("passes both halves to children", func() {
+				parent := tracer.StartSpan("root").Context().(SpanContext)
+				child := tracer.StartSpan("child", opentracing.ChildOf(parent)).Context().(SpanContext)
+				Expect(child.TraceIDHigh).To(Equal(parent.TraceIDHigh))
+				Expect(child.TraceID).To(Equal(parent.TraceID))
+			})
+
+			It("keeps the width of a 64-bit parent", func() {
+				parent := SpanContext{TraceID: 7, SpanID: 8}
+				child := tracer.StartSpan("child", opentracing.ChildOf(parent)).Context().(SpanContext)
+				Expect(child.TraceIDHigh).To(BeZero())
+				Expect(child.TraceID).To(Equal(uint64(7)))
+			})
+		})
+
+		It("honors explicit 128-bit IDs", func() {
+			sc := tracer.StartSpan("imported",
+				SetTraceID(1), SetTraceIDHigh(2), SetSpanID(3),
+			).Context().(SpanContext)
+			Expect(sc.TraceIDHex()).To(Equal("00000000000000020000000000000001"))
+			Expect(sc.SpanID).To(Equal(uint64(3)))
+		})
+	})
+
+	Describe("tag limits", func() {
+		BeforeEach(func() {
+			opts.MaxTagsPerSpan = 2
+			opts.MaxTagKeyLen = 5
+			opts.MaxTagValueLen = 5
+		})
+
+		It("truncates long keys and string values", func() {
+			sp := tracer.StartSpan("op", opentracing.Tag{Key: "longkey", Value: "longvalue"})
+			sp.SetTag("k", 1234567)
+			sp.Finish()
+			Expect(recorder.Spans()[0].Tags).To(Equal(opentracing.Tags{
+				"long" + ellipsis: "long" + ellipsis,
+				"k":               1234567,
+			}))
+		})
+
+		It("drops and counts new tags beyond the limit", func() {
+			sp := tracer.StartSpan("op", opentracing.Tags{"a": 1, "b": 2, "c": 3})
+			sp.SetTag("d", 4)
+			sp.Finish()
+
+			raw := recorder.Spans()[0]
+			Expect(raw.Tags).To(HaveLen(2))
+			Expect(raw.DroppedTagsCount).To(Equal(2))
+		})
+
+		It("still updates existing tags at the limit", func() {
+			sp := tracer.StartSpan("op", opentracing.Tags{"a": 1, "b": 2})
+			sp.SetTag("a", 3)
+			sp.Finish()
+			Expect(recorder.Spans()[0].Tags).To(Equal(opentracing.Tags{"a": 3, "b": 2}))
+			Expect(recorder.Spans()[0].DroppedTagsCount).To(BeZero())
+		})
+	})
+
+	Describe("references", func() {
+		It("records every reference and uses the first as the parent", func() {
+			first := SpanContext{TraceID: 1, SpanID: 2, Sampled: true}
+			second := SpanContext{TraceID: 3, TraceIDHigh: 4, SpanID: 5, Sampled: true}
+			tracer.StartSpan("batch",
+				opentracing.FollowsFrom(first),
+				opentracing.FollowsFrom(second),
+				opentracing.ChildOf(nil),
+			).Finish()
+
+			raw := recorder.Spans()[0]
+			Expect(raw.Context.TraceID).To(Equal(uint64(1)))
+			Expect(raw.ParentSpanID).To(Equal(uint64(2)))
+			Expect(raw.References).To(Equal([]SpanReference{
+				{Type: opentracing.FollowsFromRef, TraceID: 1, SpanID: 2},
+				{Type: opentracing.FollowsFromRef, TraceID: 3, TraceIDHigh: 4, SpanID: 5},
+			}))
+		})
+
+		It("records none for root spans", func() {
+			tracer.StartSpan("root").Finish()
+			Expect(recorder.Spans()[0].References).To(BeEmpty())
+		})
+	})
+
+	Describe("links", func() {
+		other := SpanContext{TraceID: 3, TraceIDHigh: 4, SpanID: 5, Sampled: true}
+
+		It("records links given at start and added later", func() {
+			sp := tracer.StartSpan("batch",
+				WithLink(other, opentracing.Tags{"reason": "batched"}),
+				WithLink(nil, nil),
+			)
+			AddSpanLink(sp, SpanContext{TraceID: 6, SpanID: 7}, nil)
+			sp.Finish()
+
+			raw := recorder.Spans()[0]
+			Expect(raw.ParentSpanID).To(BeZero())
+			Expect(raw.Context.TraceID).NotTo(Equal(other.TraceID))
+			Expect(raw.Links).To(Equal([]SpanLink{
+				{TraceID: 3, TraceIDHigh: 4, SpanID: 5, Attributes: opentracing.Tags{"reason": "batched"}},
+				{TraceID: 6, SpanID: 7},
+			}))
+		})
+
+		It("ignores links to invalid contexts", func() {
+			sp := tracer.StartSpan("op")
+			AddSpanLink(sp, SpanContext{}, nil)
+			sp.Finish()
+			Expect(recorder.Spans()[0].Links).To(BeEmpty())
+		})
+	})
+
+	Describe("sampling", func() {
+		It("samples root spans", func() {
+			sp := tracer.StartSpan("root")
+			Expect(sp.Context().(SpanContext).Sampled).To(BeTrue())
+			sp.Finish()
+			Expect(recorder.Spans()).To(HaveLen(1))
+		})
+
+		It("inherits the parent's decision", func() {
+			parent := SpanContext{TraceID: 1, SpanID: 2, Sampled: false}
+			sp := tracer.StartSpan("child", opentracing.ChildOf(parent))
+			Expect(sp.Context().(SpanContext).Sampled).To(BeFalse())
+
+			grandchild := tracer.StartSpan("grandchild", opentracing.ChildOf(sp.Context()))
+			Expect(grandchild.Context().(SpanContext).Sampled).To(BeFalse())
+		})
+
+		It("neither buffers logs nor records unsampled spans", func() {
+			parent := SpanContext{TraceID: 1, SpanID: 2, Sampled: false}
+			sp := tracer.StartSpan("child", opentracing.ChildOf(parent)).(*spanImpl)
+			sp.LogKV("event", "ignored")
+			sp.LogEvent("ignored")
+			Expect(sp.raw.Logs).To(BeEmpty())
+
+			sp.Finish()
+			sp.Finish()
+			Expect(recorder.Spans()).To(BeEmpty())
+			Expect(tracer.buffer.rawSpans).To(BeEmpty())
+		})
+	})
+
+	Describe("durations", func() {
+		It("measures spans timed by the tracer", func() {
+			sp := tracer.StartSpan("op")
+			time.Sleep(time.Millisecond)
+			sp.Finish()
+			raw := recorder.Spans()[0]
+			Expect(raw.Duration).To(BeNumerically(">=", time.Millisecond))
+			Expect(raw.ClockSkew).To(BeZero())
+		})
+
+		It("clamps out-of-order explicit times, and reports the skew once", func() {
+			handler, events := NewEventChannel(10)
+			SetGlobalEventHandler(handler)
+
+			start := time.Now()
+			sp := tracer.StartSpan("op", opentracing.StartTime(start))
+			sp.FinishWithOptions(opentracing.FinishOptions{FinishTime: start.Add(-time.Second)})
+			sp.Finish()
+
+			Expect(recorder.Spans()).To(HaveLen(1))
+			raw := recorder.Spans()[0]
+			Expect(raw.Duration).To(BeZero())
+			Expect(raw.ClockSkew).To(Equal(time.Second))
+
+			Eventually(events).Should(Receive(Equal(newEventClockSkew("op", time.Second))))
+		})
+
+		It("reports the skew after unlocking the span", func() {
+			start := time.Now()
+			sp := tracer.StartSpan("op", opentracing.StartTime(start))
+			var ctx opentracing.SpanContext
+			SetGlobalEventHandler(func(Event) { ctx = sp.Context() })
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				sp.FinishWithOptions(opentracing.FinishOptions{FinishTime: start.Add(-time.Second)})
+			}()
+			Eventually(done).Should(BeClosed())
+			Expect(ctx).NotTo(BeNil())
+		})
+	})
+})
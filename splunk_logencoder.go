@@ -14,16 +14,19 @@ const (
 // An implementation of the log.Encoder interface
 type splunkLogFieldEncoder struct {
 	converter *hecConverter
+	buffer    *reportBuffer
 	keyValues map[string]interface{}
 }
 
 func marshalFields(
 	converter *hecConverter,
+	buffer *reportBuffer,
 	protoLog map[string]interface{},
 	fields []log.Field,
 ) {
 	logFieldEncoder := splunkLogFieldEncoder{
 		converter: converter,
+		buffer:    buffer,
 		keyValues: make(map[string]interface{}),
 	}
 	for _, field := range fields {
@@ -45,17 +48,17 @@ func (lfe *splunkLogFieldEncoder) EmitBool(key string, value bool) {
 
 func (lfe *splunkLogFieldEncoder) EmitInt(key string, value int) {
 	safeKey := lfe.setSafeKey(key)
-	lfe.keyValues[safeKey] = value
+	lfe.keyValues[safeKey] = lfe.tagEncoder().encodeValue(key, value)
 }
 
 func (lfe *splunkLogFieldEncoder) EmitInt32(key string, value int32) {
 	safeKey := lfe.setSafeKey(key)
-	lfe.keyValues[safeKey] = value
+	lfe.keyValues[safeKey] = lfe.tagEncoder().encodeValue(key, value)
 }
 
 func (lfe *splunkLogFieldEncoder) EmitInt64(key string, value int64) {
 	safeKey := lfe.setSafeKey(key)
-	lfe.keyValues[safeKey] = value
+	lfe.keyValues[safeKey] = lfe.tagEncoder().encodeValue(key, value)
 }
 
 // N.B. We are using a string encoding for 32- and 64-bit unsigned
@@ -68,31 +71,29 @@ func (lfe *splunkLogFieldEncoder) EmitInt64(key string, value int64) {
 // strings.
 func (lfe *splunkLogFieldEncoder) EmitUint32(key string, value uint32) {
 	safeKey := lfe.setSafeKey(key)
-	lfe.keyValues[safeKey] = value
+	lfe.keyValues[safeKey] = lfe.tagEncoder().encodeValue(key, value)
 }
 
 func (lfe *splunkLogFieldEncoder) EmitUint64(key string, value uint64) {
 	safeKey := lfe.setSafeKey(key)
-	lfe.keyValues[safeKey] = value
+	lfe.keyValues[safeKey] = lfe.tagEncoder().encodeValue(key, value)
 }
 
 func (lfe *splunkLogFieldEncoder) EmitFloat32(key string, value float32) {
 	safeKey := lfe.setSafeKey(key)
-	lfe.keyValues[safeKey] = value
+	lfe.keyValues[safeKey] = lfe.tagEncoder().encodeValue(key, value)
 }
 
 func (lfe *splunkLogFieldEncoder) EmitFloat64(key string, value float64) {
 	safeKey := lfe.setSafeKey(key)
-	lfe.keyValues[safeKey] = value
+	lfe.keyValues[safeKey] = lfe.tagEncoder().encodeValue(key, value)
 }
 
 func (lfe *splunkLogFieldEncoder) EmitObject(key string, value interface{}) {
 	safeKey := lfe.setSafeKey(key)
 	jsonBytes, err := json.Marshal(value)
 	if err != nil {
-		emitEvent(newEventUnsupportedValue(key, value, err))
-		safeValue := lfe.setSafeStringValue("<json.Marshal error>")
-		lfe.keyValues[safeKey] = safeValue
+		lfe.keyValues[safeKey] = lfe.setSafeStringValue(lfe.tagEncoder().unsupported(key, value, err))
 		return
 	}
 	lfe.keyValues[safeKey] = lfe.setSafeJSONValue(string(jsonBytes))
@@ -102,11 +103,14 @@ func (lfe *splunkLogFieldEncoder) EmitLazyLogger(value log.LazyLogger) {
 	value(lfe)
 }
 
+// tagEncoder keeps numbers that JSON cannot represent exactly, or at all,
+// consistent between tags and log fields.
+func (lfe *splunkLogFieldEncoder) tagEncoder() splunkTagEncoder {
+	return splunkTagEncoder{converter: lfe.converter, buffer: lfe.buffer}
+}
+
 func (lfe *splunkLogFieldEncoder) setSafeStringValue(str string) string {
-	if lfe.converter.maxLogValueLen > 0 && len(str) > lfe.converter.maxLogValueLen {
-		str = str[:(lfe.converter.maxLogValueLen-1)] + ellipsis
-	}
-	return str
+	return truncateWithEllipsis(str, lfe.converter.maxLogValueLen)
 }
 
 func (lfe *splunkLogFieldEncoder) setSafeJSONValue(json string) string{
@@ -118,8 +122,5 @@ func (lfe *splunkLogFieldEncoder) setSafeJSONValue(json string) string{
 }
 
 func (lfe *splunkLogFieldEncoder) setSafeKey(key string) string {
-	if lfe.converter.maxLogKeyLen > 0 && len(key) > lfe.converter.maxLogKeyLen {
-		key = key[:(lfe.converter.maxLogKeyLen-1)] + ellipsis
-	}
-	return key
+	return truncateWithEllipsis(key, lfe.converter.maxLogKeyLen)
 }
\ No newline at end of file
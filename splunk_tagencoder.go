@@ -0,0 +1,120 @@
+package splunktracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// maxJSONSafeInteger is the largest integer a JSON number holds exactly in
+// the double-precision floats most JSON parsers, Splunk's included, use.
+const maxJSONSafeInteger = 1 << 53
+
+// splunkTagEncoder turns tag values into values that encoding/json is sure
+// to marshal, so that one bad tag cannot fail the whole span event.
+type splunkTagEncoder struct {
+	converter *hecConverter
+	buffer    *reportBuffer
+}
+
+// encodeTags encodes every tag value, see encodeValue.
+func (te splunkTagEncoder) encodeTags(into map[string]interface{}, tags opentracing.Tags) {
+	for key, value := range tags {
+		into[key] = te.encodeValue(key, value)
+	}
+}
+
+// encodeValue handles each kind of value explicitly:
+//   - strings, bools and numbers are kept, except that integers beyond
+//     ±2^53 are written as strings, and NaN and infinities, which JSON cannot
+//     represent, as their strconv form;
+//   - errors and fmt.Stringers are written as their string;
+//   - nil and nil pointers, including nil errors and Stringers, are written
+//     as null;
+//   - anything else is kept if encoding/json can marshal it. If it cannot,
+//     e.g. a channel, a func or a cyclic structure, the value is replaced by
+//     a placeholder string, an EventUnsupportedValue is emitted and the
+//     report's encoding error count is incremented.
+func (te splunkTagEncoder) encodeValue(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string, bool:
+		return v
+	case error:
+		if isNilPointer(v) {
+			return nil
+		}
+		return v.Error()
+	case fmt.Stringer:
+		if isNilPointer(v) {
+			return nil
+		}
+		return v.String()
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		if i > maxJSONSafeInteger || i < -maxJSONSafeInteger {
+			return strconv.FormatInt(i, 10)
+		}
+		return i
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > maxJSONSafeInteger {
+			return strconv.FormatUint(u, 10)
+		}
+		return u
+	case reflect.Float32:
+		// Kept as a float32, which encoding/json writes in its shortest
+		// 32-bit form: 0.1 rather than 0.10000000149011612.
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 32)
+		}
+		return float32(f)
+	case reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return f
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if rv.IsNil() {
+			return nil
+		}
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return te.unsupported(key, value, nil)
+	}
+
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		return te.unsupported(key, value, err)
+	}
+	return json.RawMessage(jsonBytes)
+}
+
+// isNilPointer reports whether value is a typed nil pointer, whose methods
+// may dereference it.
+func isNilPointer(value interface{}) bool {
+	rv := reflect.ValueOf(value)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+func (te splunkTagEncoder) unsupported(key string, value interface{}, err error) string {
+	emitEvent(newEventUnsupportedValue(key, value, err))
+	if te.buffer != nil {
+		te.buffer.logEncoderErrorCount++
+	}
+	return fmt.Sprintf("<unsupported value of type %T>", value)
+}
@@ -0,0 +1,127 @@
+package splunktracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+type cyclic struct {
+	Next *cyclic
+}
+
+// fieldError reads a field in Error, so a nil *fieldError panics.
+type fieldError struct {
+	msg string
+}
+
+func (e *fieldError) Error() string { return e.msg }
+
+var _ = Describe("splunkTagEncoder", func() {
+	var buffer *reportBuffer
+	var encoder splunkTagEncoder
+	var events <-chan Event
+
+	BeforeEach(func() {
+		var handler EventHandler
+		handler, events = NewEventChannel(10)
+		SetGlobalEventHandler(handler)
+
+		buffer = &reportBuffer{}
+		encoder = splunkTagEncoder{converter: newHECConverter(Options{}), buffer: buffer}
+	})
+
+	encode := func(value interface{}) string {
+		out, err := json.Marshal(encoder.encodeValue("key", value))
+		Expect(err).NotTo(HaveOccurred())
+		return string(out)
+	}
+
+	It("keeps scalars", func() {
+		Expect(encode("s")).To(Equal(`"s"`))
+		Expect(encode(true)).To(Equal(`true`))
+		Expect(encode(-42)).To(Equal(`-42`))
+		Expect(encode(uint16(7))).To(Equal(`7`))
+		Expect(encode(1.5)).To(Equal(`1.5`))
+		Expect(encode(float32(0.1))).To(Equal(`0.1`))
+		Expect(encode(ext.SpanKindRPCClientEnum)).To(Equal(`"client"`))
+		Expect(encode(nil)).To(Equal(`null`))
+	})
+
+	It("writes integers beyond 2^53 as strings", func() {
+		Expect(encode(uint64(1 << 53))).To(Equal(`9007199254740992`))
+		Expect(encode(uint64(1<<53 + 1))).To(Equal(`"9007199254740993"`))
+		Expect(encode(uint64(math.MaxUint64))).To(Equal(`"18446744073709551615"`))
+		Expect(encode(int64(math.MinInt64))).To(Equal(`"-9223372036854775808"`))
+	})
+
+	It("writes floats that JSON cannot represent as strings", func() {
+		Expect(encode(math.NaN())).To(Equal(`"NaN"`))
+		Expect(encode(math.Inf(1))).To(Equal(`"+Inf"`))
+	})
+
+	It("writes errors and Stringers as strings", func() {
+		Expect(encode(errors.New("boom"))).To(Equal(`"boom"`))
+		Expect(encode(opentracing.ChildOfRef)).To(Equal(`0`))
+	})
+
+	It("writes nil pointer errors and Stringers as null", func() {
+		var err *fieldError
+		Expect(encode(err)).To(Equal(`null`))
+		Expect(encode((*bytes.Buffer)(nil))).To(Equal(`null`))
+	})
+
+	It("embeds values that marshal as JSON", func() {
+		Expect(encode(map[string]int{"a": 1})).To(Equal(`{"a":1}`))
+		Expect(encode([]string{"x"})).To(Equal(`["x"]`))
+	})
+
+	It("replaces unsupported values and accounts for them", func() {
+		loop := &cyclic{}
+		loop.Next = loop
+		for _, value := range []interface{}{make(chan int), func() {}, loop} {
+			Expect(encoder.encodeValue("key", value)).To(HavePrefix("<unsupported value of type "))
+			Eventually(events).Should(Receive(BeAssignableToTypeOf(&eventUnsupportedValue{})))
+		}
+		Expect(buffer.logEncoderErrorCount).To(Equal(int64(3)))
+	})
+
+	It("keeps the rest of the span when one tag is unsupported", func() {
+		span := RawSpan{
+			Context:   SpanContext{TraceID: 1, SpanID: 2, Sampled: true},
+			Operation: "op",
+			Tags:      opentracing.Tags{"bad": make(chan int), "good": "yes"},
+		}
+		event := hecEvents(encoder.converter.toSpan(span, buffer, nil))[0]
+		Expect(event["tags"]).To(HaveKeyWithValue("good", "yes"))
+		Expect(event["tags"]).To(HaveKeyWithValue("bad", "<unsupported value of type chan int>"))
+		Expect(buffer.logEncoderErrorCount).To(Equal(int64(1)))
+	})
+
+	It("encodes log fields like tags", func() {
+		big := int64(1<<53 + 1)
+		out := map[string]interface{}{}
+		marshalFields(encoder.converter, nil, out, []log.Field{
+			log.Int("int", int(big)),
+			log.Int32("int32", 7),
+			log.Uint32("uint32", 7),
+			log.Float32("float32", 0.1),
+			log.Object("object", make(chan int)),
+		})
+		fields := out["fields"].(map[string]interface{})
+		Expect(fields["object"]).To(Equal("<unsupported value of type chan int>"))
+		Eventually(events).Should(Receive(BeAssignableToTypeOf(&eventUnsupportedValue{})))
+
+		delete(fields, "object")
+		jsonBytes, err := json.Marshal(fields)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(jsonBytes)).To(Equal(`{"float32":0.1,"int":"9007199254740993","int32":7,"uint32":7}`))
+	})
+})
@@ -0,0 +1,414 @@
+package splunktracing
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// Default TailSamplingOptions values.
+const (
+	DefaultTailSamplingDecisionWait = 5 * time.Second
+	DefaultTailSamplingMaxTraces    = 10000
+	DefaultTailSamplingMaxSpans     = 1000
+	DefaultTailSamplingMaxAllSpans  = 50000
+)
+
+// TailSamplingOptions configure the optional tail-sampling stage, which holds
+// finished spans grouped by trace and reports or drops each local trace as a
+// whole once its decision window has passed.
+type TailSamplingOptions struct {
+	// DecisionWait is how long to wait, after the first span of a trace
+	// finishes, before deciding whether to keep the trace. Spans of a trace
+	// that finish after its decision follow the same decision.
+	DecisionWait time.Duration `yaml:"decision_wait"`
+
+	// MaxTraces bounds the number of undecided traces held in memory. When
+	// it is reached, the oldest trace is decided early.
+	MaxTraces int `yaml:"max_traces"`
+
+	// MaxSpansPerTrace bounds the number of spans held for one trace. A
+	// trace that reaches it is decided early.
+	MaxSpansPerTrace int `yaml:"max_spans_per_trace"`
+
+	// MaxSpans bounds the number of spans held for all undecided traces,
+	// including the spans that finish while their trace is being decided.
+	// When it is exceeded, the oldest traces are decided early; if none is
+	// left to decide, such a span is dropped. Defaults to
+	// DefaultTailSamplingMaxAllSpans.
+	MaxSpans int `yaml:"max_spans"`
+
+	// Policies decide which traces are kept: a trace is kept if any policy
+	// keeps it. With no policies, every trace is kept. Debug traces are
+	// always kept.
+	Policies []TailSamplingPolicy `yaml:"-" json:"-"`
+}
+
+func (opts *TailSamplingOptions) setDefaults() {
+	if opts.DecisionWait <= 0 {
+		opts.DecisionWait = DefaultTailSamplingDecisionWait
+	}
+	if opts.MaxTraces <= 0 {
+		opts.MaxTraces = DefaultTailSamplingMaxTraces
+	}
+	if opts.MaxSpansPerTrace <= 0 {
+		opts.MaxSpansPerTrace = DefaultTailSamplingMaxSpans
+	}
+	if opts.MaxSpans <= 0 {
+		opts.MaxSpans = DefaultTailSamplingMaxAllSpans
+	}
+}
+
+// A TailSamplingPolicy decides whether a trace is kept, given the spans of
+// the trace that finished in this process.
+type TailSamplingPolicy interface {
+	Keep(spans []RawSpan) bool
+}
+
+// TailSamplingPolicyFunc adapts a function to the TailSamplingPolicy
+// interface.
+type TailSamplingPolicyFunc func(spans []RawSpan) bool
+
+// Keep satisfies the TailSamplingPolicy interface.
+func (f TailSamplingPolicyFunc) Keep(spans []RawSpan) bool {
+	return f(spans)
+}
+
+// NewErrorTailPolicy keeps traces with a span tagged with ext.Error.
+func NewErrorTailPolicy() TailSamplingPolicy {
+	return TailSamplingPolicyFunc(func(spans []RawSpan) bool {
+		for _, span := range spans {
+			switch v := span.Tags[string(ext.Error)].(type) {
+			case bool:
+				if v {
+					return true
+				}
+			case string:
+				if v == "true" {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// NewLatencyTailPolicy keeps traces with a span that lasted at least
+// threshold.
+func NewLatencyTailPolicy(threshold time.Duration) TailSamplingPolicy {
+	return TailSamplingPolicyFunc(func(spans []RawSpan) bool {
+		for _, span := range spans {
+			if span.Duration >= threshold {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// NewOperationTailPolicy keeps traces with a span of one of the given
+// operations.
+func NewOperationTailPolicy(operations ...string) TailSamplingPolicy {
+	set := make(map[string]bool, len(operations))
+	for _, op := range operations {
+		set[op] = true
+	}
+	return TailSamplingPolicyFunc(func(spans []RawSpan) bool {
+		for _, span := range spans {
+			if set[span.Operation] {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// NewProbabilisticTailPolicy keeps the given fraction of traces, deciding
+// from the trace ID like NewProbabilisticSampler.
+func NewProbabilisticTailPolicy(rate float64) TailSamplingPolicy {
+	sampler := newProbabilisticSampler(rate)
+	return TailSamplingPolicyFunc(func(spans []RawSpan) bool {
+		return len(spans) > 0 && sampler.Sample(SamplingParameters{TraceID: spans[0].Context.TraceID}).Sampled
+	})
+}
+
+type traceKey struct {
+	high, low uint64
+}
+
+func traceKeyOf(sc SpanContext) traceKey {
+	return traceKey{high: sc.TraceIDHigh, low: sc.TraceID}
+}
+
+type pendingTrace struct {
+	key       traceKey
+	firstSeen time.Time
+	spans     []RawSpan
+}
+
+// tailSampler is the tail-sampling stage between RecordSpan and the report
+// buffer.
+type tailSampler struct {
+	opts    TailSamplingOptions
+	forward func([]RawSpan)
+
+	lock    sync.Mutex
+	pending map[traceKey]*list.Element // of *pendingTrace
+	order   *list.List                 // pending traces, oldest first
+	spans   int                        // spans held by pending and deciding traces
+
+	// Traces taken out of pending whose decision is being made, with the
+	// spans that finished meanwhile. These follow the trace's decision.
+	deciding map[traceKey][]RawSpan
+
+	// Recent decisions, for spans that finish after their trace was
+	// decided. Bounded to MaxTraces entries, evicted oldest first.
+	decided      map[traceKey]bool
+	decidedOrder []traceKey
+	decidedNext  int
+
+	closeOnce sync.Once
+	closeChan chan struct{}
+	doneChan  chan struct{}
+}
+
+func newTailSampler(opts TailSamplingOptions, forward func([]RawSpan)) *tailSampler {
+	opts.setDefaults()
+	return &tailSampler{
+		opts:         opts,
+		forward:      forward,
+		pending:      map[traceKey]*list.Element{},
+		order:        list.New(),
+		deciding:     map[traceKey][]RawSpan{},
+		decided:      map[traceKey]bool{},
+		decidedOrder: make([]traceKey, 0, opts.MaxTraces),
+		closeChan:    make(chan struct{}),
+		doneChan:     make(chan struct{}),
+	}
+}
+
+// start runs the loop that decides traces as their windows expire.
+func (t *tailSampler) start() {
+	interval := t.opts.DecisionWait / 10
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	go func() {
+		defer close(t.doneChan)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				t.decideExpired(now)
+			case <-t.closeChan:
+				return
+			}
+		}
+	}()
+}
+
+// close stops the decision loop and decides every pending trace.
+func (t *tailSampler) close() {
+	t.closeOnce.Do(func() {
+		close(t.closeChan)
+		<-t.doneChan
+		t.lock.Lock()
+		traces := t.takeLocked(t.order.Len())
+		t.lock.Unlock()
+		t.decide(traces)
+	})
+}
+
+// add holds a finished span until its trace is decided.
+func (t *tailSampler) add(span RawSpan, now time.Time) {
+	key := traceKeyOf(span.Context)
+	var early []*pendingTrace
+	var evictions []*eventTailSamplingEviction
+	evict := func(elem *list.Element, reason string) {
+		trace := t.removeLocked(elem)
+		early = append(early, trace)
+		evictions = append(evictions, newEventTailSamplingEviction(trace.key, len(trace.spans), reason))
+	}
+
+	t.lock.Lock()
+	if keep, found := t.decided[key]; found {
+		t.lock.Unlock()
+		if keep {
+			t.forward([]RawSpan{span})
+		}
+		return
+	}
+	if _, found := t.deciding[key]; found {
+		for t.spans >= t.opts.MaxSpans && t.order.Len() > 0 {
+			evict(t.order.Front(), tailEvictionMaxAllSpans)
+		}
+		if t.spans < t.opts.MaxSpans {
+			t.deciding[key] = append(t.deciding[key], span)
+			t.spans++
+		} else {
+			evictions = append(evictions, newEventTailSamplingEviction(key, 1, tailEvictionLateSpan))
+		}
+		t.lock.Unlock()
+
+		for _, event := range evictions {
+			emitEvent(event)
+		}
+		t.decide(early)
+		return
+	}
+
+	elem, found := t.pending[key]
+	if !found {
+		if t.order.Len() >= t.opts.MaxTraces {
+			evict(t.order.Front(), tailEvictionMaxTraces)
+		}
+		elem = t.order.PushBack(&pendingTrace{key: key, firstSeen: now})
+		t.pending[key] = elem
+	}
+	trace := elem.Value.(*pendingTrace)
+	trace.spans = append(trace.spans, span)
+	t.spans++
+	if len(trace.spans) >= t.opts.MaxSpansPerTrace {
+		evict(elem, tailEvictionMaxSpans)
+	}
+	for t.spans > t.opts.MaxSpans && t.order.Len() > 0 {
+		evict(t.order.Front(), tailEvictionMaxAllSpans)
+	}
+	t.lock.Unlock()
+
+	for _, event := range evictions {
+		emitEvent(event)
+	}
+	t.decide(early)
+}
+
+// decideExpired decides the traces whose decision window ended by now.
+func (t *tailSampler) decideExpired(now time.Time) {
+	t.lock.Lock()
+	n := 0
+	for elem := t.order.Front(); elem != nil; elem = elem.Next() {
+		if now.Sub(elem.Value.(*pendingTrace).firstSeen) < t.opts.DecisionWait {
+			break
+		}
+		n++
+	}
+	traces := t.takeLocked(n)
+	t.lock.Unlock()
+
+	t.decide(traces)
+}
+
+// takeLocked removes the n oldest pending traces.
+func (t *tailSampler) takeLocked(n int) []*pendingTrace {
+	traces := make([]*pendingTrace, 0, n)
+	for i := 0; i < n; i++ {
+		traces = append(traces, t.removeLocked(t.order.Front()))
+	}
+	return traces
+}
+
+// removeLocked takes a trace out of pending, to be decided. Until it is,
+// its new spans are held in deciding.
+func (t *tailSampler) removeLocked(elem *list.Element) *pendingTrace {
+	trace := t.order.Remove(elem).(*pendingTrace)
+	delete(t.pending, trace.key)
+	t.spans -= len(trace.spans)
+	t.deciding[trace.key] = nil
+	return trace
+}
+
+func (t *tailSampler) decide(traces []*pendingTrace) {
+	for _, trace := range traces {
+		keep := t.keep(trace.spans)
+
+		t.lock.Lock()
+		t.rememberLocked(trace.key, keep)
+		late := t.deciding[trace.key]
+		delete(t.deciding, trace.key)
+		t.spans -= len(late)
+		t.lock.Unlock()
+
+		if keep {
+			t.forward(append(trace.spans, late...))
+		}
+	}
+}
+
+func (t *tailSampler) keep(spans []RawSpan) bool {
+	if len(t.opts.Policies) == 0 {
+		return true
+	}
+	for _, span := range spans {
+		if span.Context.Debug {
+			return true
+		}
+	}
+	for _, policy := range t.opts.Policies {
+		if policy.Keep(spans) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tailSampler) rememberLocked(key traceKey, keep bool) {
+	if len(t.decidedOrder) < cap(t.decidedOrder) {
+		t.decidedOrder = append(t.decidedOrder, key)
+	} else {
+		delete(t.decided, t.decidedOrder[t.decidedNext])
+		t.decidedOrder[t.decidedNext] = key
+		t.decidedNext = (t.decidedNext + 1) % len(t.decidedOrder)
+	}
+	t.decided[key] = keep
+}
+
+// Reasons reported by EventTailSamplingEviction.
+const (
+	tailEvictionMaxTraces   = "MaxTraces reached"
+	tailEvictionMaxSpans    = "MaxSpansPerTrace reached"
+	tailEvictionMaxAllSpans = "MaxSpans reached"
+	tailEvictionLateSpan    = "MaxSpans reached, dropped a span of a trace being decided"
+)
+
+// EventTailSamplingEviction occurs when the tail-sampling stage runs out of
+// room and decides a trace before its decision window ends, or drops a span
+// that finished while its trace was being decided.
+type EventTailSamplingEviction interface {
+	Event
+	EventTailSamplingEviction()
+	TraceID() string
+	Spans() int
+}
+
+type eventTailSamplingEviction struct {
+	traceID string
+	spans   int
+	reason  string
+}
+
+func newEventTailSamplingEviction(key traceKey, spans int, reason string) *eventTailSamplingEviction {
+	return &eventTailSamplingEviction{
+		traceID: traceIDToHex(key.high, key.low),
+		spans:   spans,
+		reason:  reason,
+	}
+}
+
+func (*eventTailSamplingEviction) Event()                     {}
+func (*eventTailSamplingEviction) EventTailSamplingEviction() {}
+
+func (e *eventTailSamplingEviction) TraceID() string {
+	return e.traceID
+}
+
+func (e *eventTailSamplingEviction) Spans() int {
+	return e.spans
+}
+
+func (e *eventTailSamplingEviction) String() string {
+	return fmt.Sprintf("tail sampling decided trace %s with %d span(s) early: %s", e.traceID, e.spans, e.reason)
+}
@@ -0,0 +1,293 @@
+package splunktracing
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+var _ = Describe("Tail sampling", func() {
+	var start time.Time
+	var forwarded [][]RawSpan
+	var lock sync.Mutex
+	var opts TailSamplingOptions
+	var sampler *tailSampler
+	var events <-chan Event
+
+	forward := func(spans []RawSpan) {
+		lock.Lock()
+		defer lock.Unlock()
+		forwarded = append(forwarded, spans)
+	}
+
+	span := func(traceID uint64, operation string, tags opentracing.Tags) RawSpan {
+		return RawSpan{
+			Context:   SpanContext{TraceID: traceID, SpanID: genSeededGUID(), Sampled: true},
+			Operation: operation,
+			Duration:  time.Millisecond,
+			Tags:      tags,
+		}
+	}
+
+	BeforeEach(func() {
+		var handler EventHandler
+		handler, events = NewEventChannel(10)
+		SetGlobalEventHandler(handler)
+
+		start = time.Unix(1500000000, 0)
+		forwarded = nil
+		opts = TailSamplingOptions{
+			DecisionWait: time.Second,
+			Policies:     []TailSamplingPolicy{NewErrorTailPolicy()},
+		}
+	})
+
+	JustBeforeEach(func() {
+		sampler = newTailSampler(opts, forward)
+	})
+
+	It("holds spans until the decision window has passed", func() {
+		sampler.add(span(1, "a", opentracing.Tags{string(ext.Error): true}), start)
+		sampler.decideExpired(start.Add(500 * time.Millisecond))
+		Expect(forwarded).To(BeEmpty())
+
+		sampler.add(span(1, "b", nil), start.Add(600*time.Millisecond))
+		sampler.decideExpired(start.Add(time.Second))
+		Expect(forwarded).To(HaveLen(1))
+		Expect(forwarded[0]).To(HaveLen(2))
+	})
+
+	It("drops whole traces that no policy keeps", func() {
+		sampler.add(span(1, "a", nil), start)
+		sampler.add(span(1, "b", nil), start)
+		sampler.decideExpired(start.Add(time.Second))
+		Expect(forwarded).To(BeEmpty())
+		Expect(sampler.pending).To(BeEmpty())
+	})
+
+	It("keeps debug traces", func() {
+		debug := span(1, "a", nil)
+		debug.Context.Debug = true
+		sampler.add(debug, start)
+		sampler.add(span(1, "b", nil), start)
+		sampler.decideExpired(start.Add(time.Second))
+		Expect(forwarded).To(HaveLen(1))
+		Expect(forwarded[0]).To(HaveLen(2))
+	})
+
+	It("applies the decision to spans that finish late", func() {
+		sampler.add(span(1, "a", opentracing.Tags{string(ext.Error): "true"}), start)
+		sampler.add(span(2, "a", nil), start)
+		sampler.decideExpired(start.Add(time.Second))
+
+		sampler.add(span(1, "late", nil), start.Add(2*time.Second))
+		sampler.add(span(2, "late", nil), start.Add(2*time.Second))
+		Expect(forwarded).To(HaveLen(2))
+		Expect(forwarded[1][0].Operation).To(Equal("late"))
+		Expect(sampler.pending).To(BeEmpty())
+	})
+
+	It("applies the decision to spans that finish while it is being made", func() {
+		deciding := true
+		opts.Policies = []TailSamplingPolicy{TailSamplingPolicyFunc(func(spans []RawSpan) bool {
+			if deciding {
+				deciding = false
+				sampler.add(span(1, "meanwhile", nil), start.Add(time.Second))
+			}
+			return true
+		})}
+		sampler = newTailSampler(opts, forward)
+
+		sampler.add(span(1, "a", nil), start)
+		sampler.decideExpired(start.Add(time.Second))
+		Expect(forwarded).To(HaveLen(1))
+		Expect(forwarded[0]).To(HaveLen(2))
+		Expect(forwarded[0][1].Operation).To(Equal("meanwhile"))
+		Expect(sampler.pending).To(BeEmpty())
+		Expect(sampler.deciding).To(BeEmpty())
+	})
+
+	It("decides everything on close", func() {
+		sampler.start()
+		sampler.add(span(1, "a", opentracing.Tags{string(ext.Error): true}), time.Now())
+		sampler.close()
+		Expect(forwarded).To(HaveLen(1))
+	})
+
+	Context("with no policies", func() {
+		BeforeEach(func() {
+			opts.Policies = nil
+		})
+
+		It("keeps every trace", func() {
+			sampler.add(span(1, "a", nil), start)
+			sampler.decideExpired(start.Add(time.Second))
+			Expect(forwarded).To(HaveLen(1))
+		})
+	})
+
+	Context("when MaxTraces is reached", func() {
+		BeforeEach(func() {
+			opts.MaxTraces = 2
+			opts.Policies = nil
+		})
+
+		It("decides the oldest trace early and emits an event", func() {
+			sampler.add(span(1, "a", nil), start)
+			sampler.add(span(2, "a", nil), start)
+			sampler.add(span(3, "a", nil), start)
+			Expect(forwarded).To(HaveLen(1))
+			Expect(forwarded[0][0].Context.TraceID).To(Equal(uint64(1)))
+			Expect(sampler.pending).To(HaveLen(2))
+
+			var event Event
+			Expect(events).To(Receive(&event))
+			eviction := event.(EventTailSamplingEviction)
+			Expect(eviction.TraceID()).To(Equal("1"))
+			Expect(eviction.Spans()).To(Equal(1))
+		})
+
+		It("bounds the memory of past decisions", func() {
+			for id := uint64(1); id <= 10; id++ {
+				sampler.add(span(id, "a", nil), start)
+			}
+			sampler.decideExpired(start.Add(time.Second))
+			Expect(sampler.decided).To(HaveLen(2))
+		})
+	})
+
+	Context("when MaxSpansPerTrace is reached", func() {
+		BeforeEach(func() {
+			opts.MaxSpansPerTrace = 2
+		})
+
+		It("decides the trace early and emits an event", func() {
+			sampler.add(span(1, "a", opentracing.Tags{string(ext.Error): true}), start)
+			sampler.add(span(1, "b", nil), start)
+			Expect(forwarded).To(HaveLen(1))
+			Expect(forwarded[0]).To(HaveLen(2))
+			Expect(events).To(Receive(BeAssignableToTypeOf(&eventTailSamplingEviction{})))
+		})
+	})
+
+	Context("when MaxSpans is exceeded", func() {
+		BeforeEach(func() {
+			opts.MaxSpans = 3
+			opts.Policies = nil
+		})
+
+		It("decides the oldest traces early and emits an event", func() {
+			sampler.add(span(1, "a", nil), start)
+			sampler.add(span(1, "b", nil), start)
+			sampler.add(span(2, "a", nil), start)
+			Expect(forwarded).To(BeEmpty())
+
+			sampler.add(span(3, "a", nil), start)
+			Expect(forwarded).To(HaveLen(1))
+			Expect(forwarded[0]).To(HaveLen(2))
+			Expect(forwarded[0][0].Context.TraceID).To(Equal(uint64(1)))
+			Expect(sampler.spans).To(Equal(2))
+
+			var event Event
+			Expect(events).To(Receive(&event))
+			Expect(event.String()).To(ContainSubstring("MaxSpans reached"))
+		})
+
+		It("counts the spans that finish while their trace is being decided", func() {
+			deciding := true
+			opts.Policies = []TailSamplingPolicy{TailSamplingPolicyFunc(func(spans []RawSpan) bool {
+				if deciding {
+					deciding = false
+					sampler.add(span(2, "a", nil), start)
+					for i := 0; i < 4; i++ {
+						sampler.add(span(1, "meanwhile", nil), start)
+					}
+				}
+				return true
+			})}
+			sampler = newTailSampler(opts, forward)
+
+			sampler.add(span(1, "a", nil), start)
+			sampler.decideExpired(start.Add(time.Second))
+
+			// Trace 2 made room for one more span, and the last one was
+			// dropped.
+			Expect(forwarded).To(HaveLen(2))
+			Expect(forwarded[0][0].Context.TraceID).To(Equal(uint64(2)))
+			Expect(forwarded[1]).To(HaveLen(4))
+			Expect(sampler.spans).To(BeZero())
+
+			var event Event
+			Expect(events).To(Receive(&event))
+			Expect(event.(EventTailSamplingEviction).TraceID()).To(Equal("2"))
+			Expect(events).To(Receive(&event))
+			Expect(event.(EventTailSamplingEviction).TraceID()).To(Equal("1"))
+			Expect(event.String()).To(ContainSubstring("dropped a span"))
+		})
+	})
+
+	Describe("policies", func() {
+		spans := func(ss ...RawSpan) []RawSpan { return ss }
+
+		It("keeps traces with errors", func() {
+			policy := NewErrorTailPolicy()
+			Expect(policy.Keep(spans(span(1, "a", opentracing.Tags{string(ext.Error): true})))).To(BeTrue())
+			Expect(policy.Keep(spans(span(1, "a", opentracing.Tags{string(ext.Error): false})))).To(BeFalse())
+			Expect(policy.Keep(spans(span(1, "a", nil)))).To(BeFalse())
+		})
+
+		It("keeps slow traces", func() {
+			slow := span(1, "a", nil)
+			slow.Duration = time.Second
+			policy := NewLatencyTailPolicy(500 * time.Millisecond)
+			Expect(policy.Keep(spans(span(1, "a", nil), slow))).To(BeTrue())
+			Expect(policy.Keep(spans(span(1, "a", nil)))).To(BeFalse())
+		})
+
+		It("keeps traces with a given operation", func() {
+			policy := NewOperationTailPolicy("checkout", "pay")
+			Expect(policy.Keep(spans(span(1, "a", nil), span(1, "pay", nil)))).To(BeTrue())
+			Expect(policy.Keep(spans(span(1, "a", nil)))).To(BeFalse())
+		})
+
+		It("keeps a fraction of traces by trace ID", func() {
+			policy := NewProbabilisticTailPolicy(0.5)
+			Expect(policy.Keep(spans(span(1, "a", nil)))).To(BeTrue())
+			Expect(policy.Keep(spans(span(maxRandomID, "a", nil)))).To(BeFalse())
+		})
+	})
+
+	Context("configured on a tracer", func() {
+		var tracer *tracerImpl
+
+		BeforeEach(func() {
+			tracer = newTestTracer(Options{TailSampling: &TailSamplingOptions{
+				DecisionWait: time.Hour,
+				Policies:     []TailSamplingPolicy{NewOperationTailPolicy("keep")},
+			}})
+		})
+
+		It("buffers kept traces once they are decided", func() {
+			root := tracer.StartSpan("keep")
+			tracer.StartSpan("child", opentracing.ChildOf(root.Context())).Finish()
+			root.Finish()
+			tracer.StartSpan("drop").Finish()
+			Expect(tracer.buffer.rawSpans).To(BeEmpty())
+
+			tracer.tailSampler.decideExpired(time.Now().Add(time.Hour))
+			Expect(tracer.buffer.rawSpans).To(HaveLen(2))
+			closeTestTracer(tracer)
+		})
+
+		It("releases pending traces on Close", func() {
+			tracer.StartSpan("keep").Finish()
+			closeTestTracer(tracer)
+			Expect(tracer.tailSampler.pending).To(BeEmpty())
+			Expect(tracer.tailSampler.decided).To(HaveLen(1))
+		})
+	})
+})
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
@@ -30,6 +31,12 @@ type Tracer interface {
 
 // Implements the `Tracer` interface. Buffers spans and forwards to a Splunk collector.
 type tracerImpl struct {
+	// Root span sampling decisions since the last status report. These are
+	// updated atomically rather than under `lock`, and come first to keep
+	// them 64-bit aligned on 32-bit platforms.
+	sampledTraces  int64
+	rejectedTraces int64
+
 	//////////////////////////////////////////////////////////////
 	// IMMUTABLE IMMUTABLE IMMUTABLE IMMUTABLE IMMUTABLE IMMUTABLE
 	//////////////////////////////////////////////////////////////
@@ -41,6 +48,27 @@ type tracerImpl struct {
 	reporterID uint64 // the LightStep tracer guid
 	opts       Options
 
+	// propagation and baggage settings derived from opts
+	propagator    Propagator
+	baggageLimits baggageLimits
+
+	// head sampling, either opts.Sampler or a remoteSampler wrapping it
+	sampler       Sampler
+	remoteSampler *remoteSampler
+
+	// optional tail-sampling stage in front of the report buffer
+	tailSampler *tailSampler
+
+	// the span pipeline: opts.SpanProcessors, then the redaction stage, then
+	// the reporting stage, then opts.Recorder
+	processors []SpanProcessor
+
+	// the optional redaction stage of the pipeline
+	redactor *redactionProcessor
+
+	// unfinished spans, if opts.TrackOpenSpans is set
+	openSpans *openSpanRegistry
+
 	// report loop management
 	closeOnce               sync.Once
 	closeReportLoopChannel  chan struct{}
@@ -101,6 +129,8 @@ func NewTracer(opts Options) Tracer {
 	impl := &tracerImpl{
 		opts:                    opts,
 		reporterID:              genSeededGUID(),
+		propagator:              append(propagatorChain{newTextMapPropagator(opts)}, opts.Propagators...),
+		baggageLimits:           newBaggageLimits(opts),
 		buffer:                  newSpansBuffer(opts.MaxBufferedSpans),
 		flushing:                newSpansBuffer(opts.MaxBufferedSpans),
 		closeReportLoopChannel:  make(chan struct{}),
@@ -109,6 +139,35 @@ func NewTracer(opts Options) Tracer {
 
 	impl.buffer.setCurrent(now)
 
+	if opts.TrackOpenSpans {
+		impl.openSpans = newOpenSpanRegistry(opts.MaxOpenSpans)
+	}
+
+	impl.processors = append(impl.processors, opts.SpanProcessors...)
+	if opts.Redaction != nil {
+		impl.redactor, err = newRedactionProcessor(*opts.Redaction)
+		if err != nil {
+			emitEvent(newEventStartError(err))
+			return nil
+		}
+		impl.processors = append(impl.processors, impl.redactor)
+	}
+	impl.processors = append(impl.processors, reportingProcessor{tracer: impl})
+	if opts.Recorder != nil {
+		impl.processors = append(impl.processors, NewSpanRecorderProcessor(opts.Recorder))
+	}
+
+	impl.sampler = opts.Sampler
+	if opts.RemoteSampling != nil {
+		serviceName, _ := opts.Tags[ComponentNameKey].(string)
+		impl.remoteSampler, err = newRemoteSampler(*opts.RemoteSampling, serviceName, opts.Sampler)
+		if err != nil {
+			emitEvent(newEventStartError(err))
+			return nil
+		}
+		impl.sampler = impl.remoteSampler
+	}
+
 	impl.client, err = newCollectorClient(opts, impl.reporterID, attributes)
 	if err != nil {
 		fmt.Println("Failed to create to Collector client!", err)
@@ -122,6 +181,14 @@ func NewTracer(opts Options) Tracer {
 	}
 	impl.connection = conn
 
+	if impl.remoteSampler != nil {
+		impl.remoteSampler.start()
+	}
+	if opts.TailSampling != nil {
+		impl.tailSampler = newTailSampler(*opts.TailSampling, impl.bufferSpans)
+		impl.tailSampler.start()
+	}
+
 	// set meta reporting to defined option
 	impl.metaEventReportingEnabled = opts.MetaEventReportingEnabled
 	impl.firstReportHasRun = false
@@ -153,7 +220,7 @@ func (tracer *tracerImpl) Inject(sc opentracing.SpanContext, format interface{},
 	}
 	switch format {
 	case opentracing.TextMap, opentracing.HTTPHeaders:
-		return theTextMapPropagator.Inject(sc, carrier)
+		return tracer.propagator.Inject(sc, carrier)
 	}
 	return opentracing.ErrUnsupportedFormat
 }
@@ -167,7 +234,7 @@ func (tracer *tracerImpl) Extract(format interface{}, carrier interface{}) (open
 	}
 	switch format {
 	case opentracing.TextMap, opentracing.HTTPHeaders:
-		return theTextMapPropagator.Extract(carrier)
+		return tracer.propagator.Extract(carrier)
 	}
 	return nil, opentracing.ErrUnsupportedFormat
 }
@@ -190,8 +257,24 @@ func (tracer *tracerImpl) reconnectClient(now time.Time) {
 // called once; subsequent calls to Close are no-ops.
 func (tracer *tracerImpl) Close(ctx context.Context) {
 	tracer.closeOnce.Do(func() {
+		// report the spans that will never finish while processors can
+		// still take them
+		tracer.reportOpenSpans()
+
 		// notify report loop that we are closing
 		close(tracer.closeReportLoopChannel)
+		if tracer.remoteSampler != nil {
+			tracer.remoteSampler.close()
+		}
+		for _, processor := range tracer.processors {
+			if closer, ok := processor.(spanProcessorCloser); ok {
+				closer.Close(ctx)
+			}
+		}
+		if tracer.tailSampler != nil {
+			// release the traces still waiting for a decision
+			tracer.tailSampler.close()
+		}
 		select {
 		case <-tracer.reportLoopClosedChannel:
 			tracer.Flush(ctx)
@@ -214,21 +297,37 @@ func (tracer *tracerImpl) Close(ctx context.Context) {
 	})
 }
 
-// RecordSpan records a finished Span.
+// RecordSpan records a finished Span by passing it down the span processor
+// pipeline.
 func (tracer *tracerImpl) RecordSpan(raw RawSpan) {
 	tracer.lock.Lock()
+	disabled := tracer.disabled
+	tracer.lock.Unlock()
 
 	// Early-out for disabled runtimes
-	if tracer.disabled {
-		tracer.lock.Unlock()
+	if disabled {
 		return
 	}
 
-	tracer.buffer.addSpan(raw)
-	tracer.lock.Unlock()
+	for _, processor := range tracer.processors {
+		var keep bool
+		if raw, keep = processor.OnFinish(raw); !keep {
+			return
+		}
+	}
+}
+
+// bufferSpans adds the spans of a trace kept by the tail-sampling stage to
+// the report buffer.
+func (tracer *tracerImpl) bufferSpans(spans []RawSpan) {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
 
-	if tracer.opts.Recorder != nil {
-		tracer.opts.Recorder.RecordSpan(raw)
+	if tracer.disabled {
+		return
+	}
+	for _, span := range spans {
+		tracer.buffer.addSpan(span)
 	}
 }
 
@@ -324,6 +423,22 @@ func (tracer *tracerImpl) postFlush(flushEventError *eventFlushError) *eventStat
 		int(tracer.flushing.droppedSpanCount+tracer.buffer.droppedSpanCount),
 		int(tracer.flushing.logEncoderErrorCount+tracer.buffer.logEncoderErrorCount),
 	)
+	statusReportEvent.setSamplingCounts(
+		int(atomic.SwapInt64(&tracer.sampledTraces, 0)),
+		int(atomic.SwapInt64(&tracer.rejectedTraces, 0)),
+	)
+	if tracer.redactor != nil {
+		statusReportEvent.setRedactions(int(atomic.SwapInt64(&tracer.redactor.redactions, 0)))
+	}
+	if observer := tracer.activeFlushObserver(); observer != nil {
+		statusReportEvent.setSamplingRate(observer.observeFlush(flushStats{
+			interval:      tracer.flushing.reportEnd.Sub(tracer.flushing.reportStart),
+			reportedSpans: len(tracer.flushing.rawSpans),
+			droppedSpans:  int(tracer.flushing.droppedSpanCount),
+			reportedBytes: tracer.flushing.reportedBytes,
+			bufferFill:    float64(len(tracer.flushing.rawSpans)) / float64(cap(tracer.flushing.rawSpans)),
+		}))
+	}
 
 	if flushEventError == nil {
 		tracer.flushing.clear()
@@ -344,6 +459,28 @@ func (tracer *tracerImpl) postFlush(flushEventError *eventFlushError) *eventStat
 	return statusReportEvent
 }
 
+// countSamplingDecision tallies a root span's final sampling decision for the
+// next status report.
+func (tracer *tracerImpl) countSamplingDecision(sampled bool) {
+	if sampled {
+		atomic.AddInt64(&tracer.sampledTraces, 1)
+	} else {
+		atomic.AddInt64(&tracer.rejectedTraces, 1)
+	}
+}
+
+// activeFlushObserver returns the sampler currently making the head-sampling
+// decisions if it adapts its rate to the reports. Once a remote strategy
+// replaces Options.Sampler, the latter is no longer fed or reported.
+func (tracer *tracerImpl) activeFlushObserver() flushObserver {
+	sampler := tracer.sampler
+	if tracer.remoteSampler != nil {
+		sampler = tracer.remoteSampler.activeSampler()
+	}
+	observer, _ := sampler.(flushObserver)
+	return observer
+}
+
 func (tracer *tracerImpl) Disable() {
 	tracer.lock.Lock()
 	if tracer.disabled {
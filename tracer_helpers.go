@@ -30,6 +30,44 @@ func Close(ctx context.Context, tracer opentracing.Tracer) {
 	}
 }
 
+// AddSpanLink links a started span to the span of sc, which usually belongs
+// to another trace, without making it the parent. See WithLink to link a
+// span as it starts. Spans and contexts from other tracers are ignored.
+func AddSpanLink(span opentracing.Span, sc opentracing.SpanContext, attributes opentracing.Tags) {
+	if splkSpan, ok := span.(*spanImpl); ok {
+		splkSpan.AddLink(sc, attributes)
+	}
+}
+
+// OpenSpans lists the spans of the tracer that have started but not
+// finished, oldest first. It requires Options.TrackOpenSpans.
+func OpenSpans(tracer opentracing.Tracer) []OpenSpan {
+	switch splkTracer := tracer.(type) {
+	case *tracerImpl:
+		return splkTracer.openSpans.describe()
+	case *tracerv0_14:
+		return OpenSpans(splkTracer.Tracer)
+	default:
+		emitEvent(newEventUnsupportedTracer(tracer))
+		return nil
+	}
+}
+
+// ReportOpenSpans reports the sampled spans listed by OpenSpans as partial
+// spans, with incomplete set and their duration so far. The spans are
+// reported again when they finish. Tracer.Close does this with the spans
+// left open. It requires Options.TrackOpenSpans.
+func ReportOpenSpans(tracer opentracing.Tracer) {
+	switch splkTracer := tracer.(type) {
+	case *tracerImpl:
+		splkTracer.reportOpenSpans()
+	case *tracerv0_14:
+		ReportOpenSpans(splkTracer.Tracer)
+	default:
+		emitEvent(newEventUnsupportedTracer(tracer))
+	}
+}
+
 // GetSplunkAccessToken returns the currently configured AccessToken.
 func GetSplunkAccessToken(tracer opentracing.Tracer) (string, error) {
 	switch splkTracer := tracer.(type) {
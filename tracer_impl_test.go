@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/lightstep/lightstep-tracer-common/golang/gogo/collectorpb"
 	"github.com/lightstep/lightstep-tracer-common/golang/gogo/collectorpb/collectorpbfakes"
@@ -116,3 +117,18 @@ func (f *fakeCollectorClient) ConnectClient() (Connection, error) {
 func (f *fakeCollectorClient) ShouldReconnect() bool {
 	return f.shouldReconnect()
 }
+
+// newTestTracer starts a tracer for specs that only inspect in-process state.
+// Callers should Close it so its report loop exits.
+func newTestTracer(opts Options) *tracerImpl {
+	if opts.AccessToken == "" {
+		opts.AccessToken = "ACCESS_TOKEN"
+	}
+	return NewTracer(opts).(*tracerImpl)
+}
+
+func closeTestTracer(tracer *tracerImpl) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	tracer.Close(ctx)
+}
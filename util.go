@@ -1,6 +1,7 @@
 package splunktracing
 
 import (
+	"fmt"
 	"runtime"
 	"time"
 	"strconv"
@@ -36,3 +37,41 @@ func idToHex(id uint64) string {
 	hex_guid := strconv.FormatInt(int64(id), 16)
 	return hex_guid
 }
+
+// traceIDToHex formats a trace ID. 128-bit IDs are written as 32 zero-padded
+// hex characters; 64-bit IDs keep the unpadded form older peers expect.
+func traceIDToHex(high, low uint64) string {
+	if high == 0 {
+		return strconv.FormatUint(low, 16)
+	}
+	return fmt.Sprintf("%016x%016x", high, low)
+}
+
+// hexToTraceID parses a trace ID of up to 32 hex characters. Anything longer
+// than 16 characters carries the upper 64 bits of a 128-bit ID.
+func hexToTraceID(s string) (high, low uint64, err error) {
+	if len(s) == 0 || len(s) > 32 {
+		return 0, 0, strconv.ErrSyntax
+	}
+	if len(s) > 16 {
+		high, err = strconv.ParseUint(s[:len(s)-16], 16, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		s = s[len(s)-16:]
+	}
+	low, err = strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return high, low, nil
+}
+
+// truncateWithEllipsis shortens str to maxLen characters, ending it with an
+// ellipsis, if it is longer. A maxLen of zero or less leaves str unchanged.
+func truncateWithEllipsis(str string, maxLen int) string {
+	if maxLen > 0 && len(str) > maxLen {
+		return str[:maxLen-1] + ellipsis
+	}
+	return str
+}
@@ -127,3 +127,33 @@ func BenchmarkGenSeededRandomID(b *testing.B) {
 		}
 	})
 }
+
+var _ = Describe("hexToTraceID", func() {
+	It("parses 64-bit IDs into the low half", func() {
+		high, low, err := hexToTraceID("abc")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(high).To(BeZero())
+		Expect(low).To(Equal(uint64(0xabc)))
+	})
+
+	It("parses 128-bit IDs", func() {
+		high, low, err := hexToTraceID("00000000000000020000000000000001")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(high).To(Equal(uint64(2)))
+		Expect(low).To(Equal(uint64(1)))
+	})
+
+	It("round-trips through traceIDToHex", func() {
+		high, low, err := hexToTraceID(traceIDToHex(0xdead, 0xbeef))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(high).To(Equal(uint64(0xdead)))
+		Expect(low).To(Equal(uint64(0xbeef)))
+	})
+
+	It("rejects empty and oversized input", func() {
+		_, _, err := hexToTraceID("")
+		Expect(err).To(HaveOccurred())
+		_, _, err = hexToTraceID("100000000000000000000000000000000")
+		Expect(err).To(HaveOccurred())
+	})
+})